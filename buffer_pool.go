@@ -0,0 +1,104 @@
+package nex
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"hash"
+	"sync"
+
+	crunch "github.com/superwhiskers/crunch/v3"
+)
+
+// * Buffers which grew larger than this, from unusually large
+// * packets, are dropped rather than kept around in the pool
+const maxPooledBufferSize = 64 * 1024
+
+// packetBufferPool holds the buffers packets are encoded into before being sent.
+// Sized for a full PRUDP packet at the usual MTUs
+var packetBufferPool = sync.Pool{
+	New: func() any {
+		buffer := make([]byte, 0, 1500)
+		return &buffer
+	},
+}
+
+// getPacketBuffer returns an empty buffer from the pool
+func getPacketBuffer() *[]byte {
+	buffer := packetBufferPool.Get().(*[]byte)
+	*buffer = (*buffer)[:0]
+
+	return buffer
+}
+
+// putPacketBuffer returns a buffer to the pool. The buffer must not be used after this
+func putPacketBuffer(buffer *[]byte) {
+	if cap(*buffer) > maxPooledBufferSize {
+		return
+	}
+
+	packetBufferPool.Put(buffer)
+}
+
+// byteStreamInPool holds the streams inbound datagrams are decoded from
+var byteStreamInPool = sync.Pool{
+	New: func() any {
+		return &ByteStreamIn{
+			Buffer: crunch.NewBuffer(),
+		}
+	},
+}
+
+// getByteStreamIn returns a stream from the pool holding a copy of data.
+// Packets decoded from the stream copy everything they keep, so the stream can be
+// returned to the pool with putByteStreamIn as soon as decoding has finished
+func getByteStreamIn(data []byte, libraryVersions *LibraryVersions, settings *ByteStreamSettings) *ByteStreamIn {
+	stream := byteStreamInPool.Get().(*ByteStreamIn)
+
+	stream.Reset()
+	stream.Grow(int64(len(data)))
+	stream.WriteBytes(0, data)
+	stream.LibraryVersions = libraryVersions
+	stream.Settings = settings
+
+	return stream
+}
+
+// putByteStreamIn returns a stream to the pool. The stream must not be used after this
+func putByteStreamIn(stream *ByteStreamIn) {
+	if cap(stream.Bytes()) > maxPooledBufferSize {
+		return
+	}
+
+	stream.LibraryVersions = nil
+	stream.Settings = nil
+
+	byteStreamInPool.Put(stream)
+}
+
+// signatureMAC is a reusable HMAC for packet signatures, along with the key it was created with
+type signatureMAC struct {
+	hash.Hash
+	key [md5.Size]byte
+}
+
+// signatureMACPool holds the HMACs used to sign PRUDPv0 and PRUDPv1 packets.
+// Creating one allocates several times, and most packets sent need a signature
+var signatureMACPool = sync.Pool{
+	New: func() any {
+		return &signatureMAC{}
+	},
+}
+
+// getSignatureMAC returns an HMAC from the pool keyed with key, ready to be written to
+func getSignatureMAC(key [md5.Size]byte) *signatureMAC {
+	mac := signatureMACPool.Get().(*signatureMAC)
+
+	if mac.Hash == nil || mac.key != key {
+		mac.Hash = hmac.New(md5.New, key[:])
+		mac.key = key
+	} else {
+		mac.Reset()
+	}
+
+	return mac
+}
@@ -1,7 +1,9 @@
 package nex
 
 import (
+	"encoding/binary"
 	"errors"
+	"math"
 
 	crunch "github.com/superwhiskers/crunch/v3"
 )
@@ -83,7 +85,7 @@ func (bsi *ByteStreamIn) ReadUInt16LE() (uint16, error) {
 		return 0, errors.New("Not enough data to read uint16")
 	}
 
-	return bsi.ReadU16LENext(1)[0], nil
+	return binary.LittleEndian.Uint16(bsi.ReadBytesNext(2)), nil
 }
 
 // ReadUInt32LE reads a Little-Endian encoded uint32
@@ -92,7 +94,7 @@ func (bsi *ByteStreamIn) ReadUInt32LE() (uint32, error) {
 		return 0, errors.New("Not enough data to read uint32")
 	}
 
-	return bsi.ReadU32LENext(1)[0], nil
+	return binary.LittleEndian.Uint32(bsi.ReadBytesNext(4)), nil
 }
 
 // ReadUInt64LE reads a Little-Endian encoded uint64
@@ -101,7 +103,7 @@ func (bsi *ByteStreamIn) ReadUInt64LE() (uint64, error) {
 		return 0, errors.New("Not enough data to read uint64")
 	}
 
-	return bsi.ReadU64LENext(1)[0], nil
+	return binary.LittleEndian.Uint64(bsi.ReadBytesNext(8)), nil
 }
 
 // ReadInt8 reads a uint8
@@ -119,7 +121,7 @@ func (bsi *ByteStreamIn) ReadInt16LE() (int16, error) {
 		return 0, errors.New("Not enough data to read int16")
 	}
 
-	return int16(bsi.ReadU16LENext(1)[0]), nil
+	return int16(binary.LittleEndian.Uint16(bsi.ReadBytesNext(2))), nil
 }
 
 // ReadInt32LE reads a Little-Endian encoded int32
@@ -128,7 +130,7 @@ func (bsi *ByteStreamIn) ReadInt32LE() (int32, error) {
 		return 0, errors.New("Not enough data to read int32")
 	}
 
-	return int32(bsi.ReadU32LENext(1)[0]), nil
+	return int32(binary.LittleEndian.Uint32(bsi.ReadBytesNext(4))), nil
 }
 
 // ReadInt64LE reads a Little-Endian encoded int64
@@ -137,7 +139,7 @@ func (bsi *ByteStreamIn) ReadInt64LE() (int64, error) {
 		return 0, errors.New("Not enough data to read int64")
 	}
 
-	return int64(bsi.ReadU64LENext(1)[0]), nil
+	return int64(binary.LittleEndian.Uint64(bsi.ReadBytesNext(8))), nil
 }
 
 // ReadFloat32LE reads a Little-Endian encoded float32
@@ -146,7 +148,7 @@ func (bsi *ByteStreamIn) ReadFloat32LE() (float32, error) {
 		return 0, errors.New("Not enough data to read float32")
 	}
 
-	return bsi.ReadF32LENext(1)[0], nil
+	return math.Float32frombits(binary.LittleEndian.Uint32(bsi.ReadBytesNext(4))), nil
 }
 
 // ReadFloat64LE reads a Little-Endian encoded float64
@@ -155,7 +157,7 @@ func (bsi *ByteStreamIn) ReadFloat64LE() (float64, error) {
 		return 0, errors.New("Not enough data to read float64")
 	}
 
-	return bsi.ReadF64LENext(1)[0], nil
+	return math.Float64frombits(binary.LittleEndian.Uint64(bsi.ReadBytesNext(8))), nil
 }
 
 // ReadBool reads a bool
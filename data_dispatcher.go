@@ -0,0 +1,96 @@
+package nex
+
+import "sync"
+
+// DataDispatcher delivers the DATA packets of a PRUDPConnection to the "data" event handlers of its endpoint.
+// Packets are handed over once they have been reassembled, while the connection is still locked, but the
+// handlers are run in their own goroutines. This keeps slow handlers, such as ones making database calls,
+// from holding up ACKs, pings and other substreams on the connection. Packets are given to handlers in the
+// order they were dispatched, with at most StreamSettings.DataHandlerConcurrency handlers running at once.
+// Handlers may send packets, since PRUDPServer.Send takes the connection lock itself
+type DataDispatcher struct {
+	connection *PRUDPConnection
+	queue      []PRUDPPacketInterface
+	running    uint32 // * Number of goroutines currently running handlers
+	mutex      *sync.Mutex
+}
+
+// Dispatch adds a packet to the end of the queue, starting a new handler goroutine if the concurrency limit allows it
+func (dd *DataDispatcher) Dispatch(packet PRUDPPacketInterface) {
+	server := dd.connection.endpoint.Server
+
+	// * Counted as in-flight so that Shutdown
+	// * waits for the handlers to finish
+	server.inFlightPackets.Add(1)
+
+	dd.mutex.Lock()
+	defer dd.mutex.Unlock()
+
+	dd.queue = append(dd.queue, packet)
+
+	if dd.running < dd.concurrency() {
+		dd.running++
+		go dd.run()
+	}
+}
+
+// QueueDepth returns the number of packets waiting for a handler
+func (dd *DataDispatcher) QueueDepth() int {
+	dd.mutex.Lock()
+	defer dd.mutex.Unlock()
+
+	return len(dd.queue)
+}
+
+// Purge drops all packets which are waiting for a handler. Handlers which are already running are not stopped
+func (dd *DataDispatcher) Purge() {
+	dd.mutex.Lock()
+	defer dd.mutex.Unlock()
+
+	server := dd.connection.endpoint.Server
+
+	for range dd.queue {
+		server.packetProcessed()
+	}
+
+	clear(dd.queue)
+	dd.queue = dd.queue[:0]
+}
+
+// concurrency returns the max number of handlers which may run at once. Must be called with the mutex held
+func (dd *DataDispatcher) concurrency() uint32 {
+	return max(dd.connection.StreamSettings.DataHandlerConcurrency, 1)
+}
+
+// run emits the "data" event for queued packets until the queue is empty
+func (dd *DataDispatcher) run() {
+	endpoint := dd.connection.endpoint
+
+	for {
+		dd.mutex.Lock()
+
+		if len(dd.queue) == 0 {
+			dd.running--
+			dd.mutex.Unlock()
+			return
+		}
+
+		packet := dd.queue[0]
+		dd.queue[0] = nil
+		dd.queue = dd.queue[1:]
+
+		dd.mutex.Unlock()
+
+		endpoint.Emit("data", packet)
+		endpoint.Server.packetProcessed()
+	}
+}
+
+// NewDataDispatcher returns a new DataDispatcher for a PRUDPConnection
+func NewDataDispatcher(connection *PRUDPConnection) *DataDispatcher {
+	return &DataDispatcher{
+		connection: connection,
+		queue:      make([]PRUDPPacketInterface, 0),
+		mutex:      &sync.Mutex{},
+	}
+}
@@ -0,0 +1,84 @@
+package nex
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// ErrDeliveryTimeout is returned by a DeliveryHandle when a fragment was resent StreamSettings.MaxPacketRetransmissions
+	// times without being acknowledged
+	ErrDeliveryTimeout = errors.New("Message was not acknowledged before running out of retransmissions")
+
+	// ErrDeliveryConnectionClosed is returned by a DeliveryHandle when the connection was closed before
+	// every fragment was acknowledged
+	ErrDeliveryConnectionClosed = errors.New("Connection closed before the message was acknowledged")
+
+	// ErrDeliveryWindowOverflow is returned by a DeliveryHandle when the message was dropped because too many packets
+	// were already waiting to be sent, see StreamSettings.MaxQueuedPackets
+	ErrDeliveryWindowOverflow = errors.New("Message was dropped because the send queue was full")
+)
+
+// DeliveryHandle reports whether a message sent with PRUDPServer.SendWithConfirmation was delivered.
+// Reliable messages are delivered once every fragment has been acknowledged. Other messages are never
+// acknowledged, so they count as delivered once every fragment has been written to the socket
+type DeliveryHandle struct {
+	remaining atomic.Int32 // * Fragments which have not been delivered yet
+	done      chan struct{}
+	once      sync.Once
+	err       error
+}
+
+// Done returns a channel which is closed once the message has been delivered or has failed
+func (dh *DeliveryHandle) Done() <-chan struct{} {
+	return dh.done
+}
+
+// Err returns nil if the message was delivered, or the reason it failed. Only valid once Done is closed
+func (dh *DeliveryHandle) Err() error {
+	select {
+	case <-dh.done:
+		return dh.err
+	default:
+		return nil
+	}
+}
+
+// Wait blocks until the message has been delivered or has failed, returning the same error as Err.
+// If the context ends first its error is returned instead, and the message may still be delivered later
+func (dh *DeliveryHandle) Wait(ctx context.Context) error {
+	select {
+	case <-dh.done:
+		return dh.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// delivered marks one fragment as delivered, resolving the handle once every fragment has been
+func (dh *DeliveryHandle) delivered() {
+	if dh.remaining.Add(-1) == 0 {
+		dh.resolve(nil)
+	}
+}
+
+// fail resolves the handle with err. Only the first failure is kept
+func (dh *DeliveryHandle) fail(err error) {
+	dh.resolve(err)
+}
+
+func (dh *DeliveryHandle) resolve(err error) {
+	dh.once.Do(func() {
+		dh.err = err
+		close(dh.done)
+	})
+}
+
+// newDeliveryHandle returns a new DeliveryHandle. The number of fragments is set once the message has been split
+func newDeliveryHandle() *DeliveryHandle {
+	return &DeliveryHandle{
+		done: make(chan struct{}),
+	}
+}
@@ -0,0 +1,17 @@
+package nex
+
+// DuplicateLoginPolicy decides what happens when a user connects to a secure PRUDPEndPoint
+// while they already have a connection to it, such as when a console reconnects before its
+// old connection has timed out
+type DuplicateLoginPolicy uint8
+
+const (
+	// DuplicateLoginAllow lets a user have several connections at once
+	DuplicateLoginAllow DuplicateLoginPolicy = iota
+
+	// DuplicateLoginReject rejects the new connection with ConcurrentLoginDenied, keeping the old one
+	DuplicateLoginReject
+
+	// DuplicateLoginKickOld disconnects the old connections, keeping the new one
+	DuplicateLoginKickOld
+)
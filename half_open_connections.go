@@ -0,0 +1,91 @@
+package nex
+
+import (
+	"net"
+	"sync"
+)
+
+// halfOpenConnections counts the connections which have started a handshake but not completed it yet.
+// Keeps floods of SYN packets, which usually have spoofed addresses, from making the server store an
+// unbounded number of connections. Limits are checked globally, per IP and per endpoint
+type halfOpenConnections struct {
+	total      int
+	byIP       map[string]int
+	byEndpoint map[*PRUDPEndPoint]int
+	mutex      *sync.Mutex
+}
+
+// add counts a new half-open connection. Returns false if any of the limits have been reached
+func (hoc *halfOpenConnections) add(endpoint *PRUDPEndPoint, address net.Addr) bool {
+	hoc.mutex.Lock()
+	defer hoc.mutex.Unlock()
+
+	server := endpoint.Server
+	ip := addressHost(address)
+
+	if server.MaxHalfOpenConnections != 0 && hoc.total >= server.MaxHalfOpenConnections {
+		return false
+	}
+
+	if server.MaxHalfOpenConnectionsPerIP != 0 && hoc.byIP[ip] >= server.MaxHalfOpenConnectionsPerIP {
+		return false
+	}
+
+	if endpoint.MaxHalfOpenConnections != 0 && hoc.byEndpoint[endpoint] >= endpoint.MaxHalfOpenConnections {
+		return false
+	}
+
+	hoc.total++
+	hoc.byIP[ip]++
+	hoc.byEndpoint[endpoint]++
+
+	return true
+}
+
+// remove stops counting a half-open connection
+func (hoc *halfOpenConnections) remove(endpoint *PRUDPEndPoint, address net.Addr) {
+	hoc.mutex.Lock()
+	defer hoc.mutex.Unlock()
+
+	ip := addressHost(address)
+
+	hoc.total--
+
+	if hoc.byIP[ip]--; hoc.byIP[ip] <= 0 {
+		delete(hoc.byIP, ip)
+	}
+
+	if hoc.byEndpoint[endpoint]--; hoc.byEndpoint[endpoint] <= 0 {
+		delete(hoc.byEndpoint, endpoint)
+	}
+}
+
+// count returns the number of half-open connections on the given endpoint, or on all endpoints if nil
+func (hoc *halfOpenConnections) count(endpoint *PRUDPEndPoint) int {
+	hoc.mutex.Lock()
+	defer hoc.mutex.Unlock()
+
+	if endpoint == nil {
+		return hoc.total
+	}
+
+	return hoc.byEndpoint[endpoint]
+}
+
+// addressHost returns the IP of an address, without the port
+func addressHost(address net.Addr) string {
+	host, _, err := net.SplitHostPort(address.String())
+	if err != nil {
+		return address.String()
+	}
+
+	return host
+}
+
+func newHalfOpenConnections() *halfOpenConnections {
+	return &halfOpenConnections{
+		byIP:       make(map[string]int),
+		byEndpoint: make(map[*PRUDPEndPoint]int),
+		mutex:      &sync.Mutex{},
+	}
+}
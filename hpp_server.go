@@ -1,7 +1,9 @@
 package nex
 
 import (
+	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
@@ -140,26 +142,62 @@ func (s *HPPServer) handleRequest(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
-// Listen starts a HPP server on a given port
+// Listen starts a HPP server on a given port.
+// Panics if the listener cannot be opened. See Serve to handle errors
 func (s *HPPServer) Listen(port int) {
-	s.server.Addr = fmt.Sprintf(":%d", port)
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		panic(err)
+	}
 
-	err := s.server.ListenAndServe()
+	err = s.Serve(listener)
 	if err != nil {
 		panic(err)
 	}
 }
 
-// ListenSecure starts a HPP server on a given port using a secure (TLS) server
+// Serve starts a HPP server on the provided listener.
+// Blocks until the listener is closed or fails. Returns nil if the server was stopped by Shutdown
+func (s *HPPServer) Serve(listener net.Listener) error {
+	err := s.server.Serve(listener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// ListenSecure starts a HPP server on a given port using a secure (TLS) server.
+// Panics if the listener cannot be opened. See ServeSecure to handle errors
 func (s *HPPServer) ListenSecure(port int, certFile, keyFile string) {
-	s.server.Addr = fmt.Sprintf(":%d", port)
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		panic(err)
+	}
 
-	err := s.server.ListenAndServeTLS(certFile, keyFile)
+	err = s.ServeSecure(listener, certFile, keyFile)
 	if err != nil {
 		panic(err)
 	}
 }
 
+// ServeSecure starts a HPP server on the provided listener using a secure (TLS) server.
+// Blocks until the listener is closed or fails. Returns nil if the server was stopped by Shutdown
+func (s *HPPServer) ServeSecure(listener net.Listener, certFile, keyFile string) error {
+	err := s.server.ServeTLS(listener, certFile, keyFile)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// Shutdown stops the server from accepting new requests and waits for the requests
+// being handled to finish. Returns the context error if it ends first
+func (s *HPPServer) Shutdown(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
 // Send sends the packet to the packets sender
 func (s *HPPServer) Send(packet PacketInterface) {
 	if packet, ok := packet.(*HPPPacket); ok {
@@ -0,0 +1,117 @@
+package nex
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1 to a temporary directory,
+// returning the paths of the certificate and key files
+func writeTestCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	certificate, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateKey, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	directory := t.TempDir()
+	certFile := filepath.Join(directory, "cert.pem")
+	keyFile := filepath.Join(directory, "key.pem")
+
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateKey}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return certFile, keyFile
+}
+
+func TestHPPServerServe(t *testing.T) {
+	for _, secure := range []bool{false, true} {
+		server := NewHPPServer()
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		served := make(chan error, 1)
+		client := &http.Client{}
+		url := "http://" + listener.Addr().String() + "/hpp/"
+
+		if secure {
+			certFile, keyFile := writeTestCertificate(t)
+
+			go func() {
+				served <- server.ServeSecure(listener, certFile, keyFile)
+			}()
+
+			client.Transport = &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			}
+			url = "https://" + listener.Addr().String() + "/hpp/"
+		} else {
+			go func() {
+				served <- server.Serve(listener)
+			}()
+		}
+
+		// * Requests without the HPP headers are rejected
+		response, err := client.Post(url, "application/octet-stream", nil)
+		if assert.NoError(t, err) {
+			assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+			response.Body.Close()
+		}
+
+		assert.NoError(t, server.Shutdown(context.Background()))
+
+		// * Stopping the server is not an error
+		assert.NoError(t, <-served)
+	}
+}
+
+func TestHPPServerServeClosedListener(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	listener.Close()
+
+	assert.Error(t, NewHPPServer().Serve(listener))
+}
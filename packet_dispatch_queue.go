@@ -1,5 +1,7 @@
 package nex
 
+import "fmt"
+
 // PacketDispatchQueue is an implementation of rdv::PacketDispatchQueue.
 // PacketDispatchQueue is used to sequence incoming packets.
 // In the original library each virtual connection stream only uses a single PacketDispatchQueue, but starting
@@ -7,10 +9,63 @@ package nex
 type PacketDispatchQueue struct {
 	queue                  map[uint16]PRUDPPacketInterface
 	nextExpectedSequenceId *Counter[uint16]
+	streamSettings         *StreamSettings
+}
+
+// checkLimits returns an error if buffering the packet would break the limits set by
+// StreamSettings.MaxReorderDistance or StreamSettings.MaxBufferedPackets
+func (pdq *PacketDispatchQueue) checkLimits(packet PRUDPPacketInterface) error {
+	sequenceID := packet.SequenceID()
+	nextExpected := pdq.nextExpectedSequenceId.Value
+
+	// * Packets which were already dispatched are never buffered
+	if sequenceIDLess(sequenceID, nextExpected) {
+		return nil
+	}
+
+	if maxDistance := pdq.streamSettings.MaxReorderDistance; maxDistance != 0 && uint32(sequenceID-nextExpected) > maxDistance {
+		return fmt.Errorf("Sequence ID %d is more than %d ahead of the next expected sequence ID %d", sequenceID, maxDistance, nextExpected)
+	}
+
+	// * Duplicates replace the packet already buffered, and the next
+	// * expected packet is always let in so the queue can drain
+	if _, ok := pdq.queue[sequenceID]; ok || sequenceID == nextExpected {
+		return nil
+	}
+
+	if maxBuffered := pdq.streamSettings.MaxBufferedPackets; maxBuffered != 0 && uint32(len(pdq.queue)) >= maxBuffered {
+		return fmt.Errorf("Sequence ID %d cannot be buffered, %d packets are already waiting to be dispatched", sequenceID, len(pdq.queue))
+	}
+
+	return nil
 }
 
-// Queue adds a packet to the queue to be dispatched
+// isFresh returns whether a packet has not been received yet, and would be accepted by Queue
+func (pdq *PacketDispatchQueue) isFresh(packet PRUDPPacketInterface) bool {
+	if sequenceIDLess(packet.SequenceID(), pdq.nextExpectedSequenceId.Value) {
+		return false
+	}
+
+	if _, ok := pdq.queue[packet.SequenceID()]; ok {
+		return false
+	}
+
+	return pdq.checkLimits(packet) == nil
+}
+
+// Queue adds a packet to the queue to be dispatched. Packets which come before the next expected sequence ID,
+// such as resends of packets which were already dispatched, are dropped. This keeps the queue from growing
+// forever, and from mistaking an old packet for a new one once sequence IDs wrap around. Packets which are
+// too far ahead, or which arrive while the queue is full, are also dropped
 func (pdq *PacketDispatchQueue) Queue(packet PRUDPPacketInterface) {
+	if sequenceIDLess(packet.SequenceID(), pdq.nextExpectedSequenceId.Value) {
+		return
+	}
+
+	if pdq.checkLimits(packet) != nil {
+		return
+	}
+
 	pdq.queue[packet.SequenceID()] = packet
 }
 
@@ -40,5 +95,6 @@ func NewPacketDispatchQueue() *PacketDispatchQueue {
 	return &PacketDispatchQueue{
 		queue:                  make(map[uint16]PRUDPPacketInterface),
 		nextExpectedSequenceId: NewCounter[uint16](2), // * First DATA packet from a client will always be 2 as the CONNECT packet is assigned 1
+		streamSettings:         NewStreamSettings(),
 	}
 }
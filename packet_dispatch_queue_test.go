@@ -61,3 +61,64 @@ func makePacket(sequenceID uint16) PRUDPPacketInterface {
 
 	return packet
 }
+
+func TestDispatchAcrossWrap(t *testing.T) {
+	pdq := NewPacketDispatchQueue()
+	pdq.nextExpectedSequenceId.Value = 65534
+
+	packets := []PRUDPPacketInterface{makePacket(65534), makePacket(65535), makePacket(0), makePacket(1)}
+
+	pdq.Queue(packets[3])
+	pdq.Queue(packets[2])
+	pdq.Queue(packets[1])
+	pdq.Queue(packets[0])
+
+	dispatched := make([]PRUDPPacketInterface, 0)
+
+	for nextPacket, ok := pdq.GetNextToDispatch(); ok; nextPacket, ok = pdq.GetNextToDispatch() {
+		dispatched = append(dispatched, nextPacket)
+		pdq.Dispatched(nextPacket)
+	}
+
+	assert.Equal(t, packets, dispatched)
+	assert.Equal(t, uint16(2), pdq.nextExpectedSequenceId.Value)
+
+	// * Resends of packets which were already dispatched are dropped
+	pdq.Queue(makePacket(65535))
+	pdq.Queue(makePacket(1))
+
+	assert.Empty(t, pdq.queue)
+}
+
+func TestPacketDispatchQueueLimits(t *testing.T) {
+	pdq := NewPacketDispatchQueue()
+	pdq.streamSettings.MaxReorderDistance = 4
+	pdq.streamSettings.MaxBufferedPackets = 2
+
+	// * Too far ahead of the next expected sequence ID, 2
+	assert.Error(t, pdq.checkLimits(makePacket(7)))
+	assert.NoError(t, pdq.checkLimits(makePacket(6)))
+
+	pdq.Queue(makePacket(7))
+	assert.Empty(t, pdq.queue)
+
+	pdq.Queue(makePacket(4))
+	pdq.Queue(makePacket(5))
+
+	// * The queue is full, but duplicates and the next expected packet are still let in
+	assert.Error(t, pdq.checkLimits(makePacket(6)))
+	assert.NoError(t, pdq.checkLimits(makePacket(4)))
+	assert.NoError(t, pdq.checkLimits(makePacket(2)))
+
+	pdq.Queue(makePacket(6))
+	assert.Len(t, pdq.queue, 2)
+
+	// * Already dispatched packets are dropped by Queue, not rejected
+	pdq.nextExpectedSequenceId.Value = 65534
+	assert.NoError(t, pdq.checkLimits(makePacket(65533)))
+
+	// * Distances are measured across the wrap
+	pdq.Purge()
+	assert.NoError(t, pdq.checkLimits(makePacket(2)))
+	assert.Error(t, pdq.checkLimits(makePacket(3)))
+}
@@ -0,0 +1,140 @@
+package nex
+
+import (
+	"sync"
+	"time"
+)
+
+// PacketPacer spaces out the DATA packets sent to a PRUDPConnection, so slow clients are not overwhelmed.
+// It is a token bucket refilled at StreamSettings.PacingRate packets per second, holding up to
+// StreamSettings.PacingBurst tokens. When the RTT of the connection is known the rate is lowered so
+// that no more than a full SlidingWindow is sent per round trip. Queued packets are sent by timers,
+// so queueing never blocks the caller
+type PacketPacer struct {
+	connection *PRUDPConnection
+	queue      []PRUDPPacketInterface
+	tokens     float64
+	lastRefill time.Time // * Zero until the first packet, so the bucket starts full
+	timer      *time.Timer
+	mutex      *sync.Mutex
+}
+
+// Queue adds packets to the end of the send queue. Packets are sent immediately if there are enough tokens.
+// The pacer takes ownership of the packets, and returns them to their pool once sent
+func (pp *PacketPacer) Queue(packets ...PRUDPPacketInterface) {
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+
+	pp.queue = append(pp.queue, packets...)
+	pp.flush()
+}
+
+// QueueDepth returns the number of packets waiting to be sent
+func (pp *PacketPacer) QueueDepth() int {
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+
+	return len(pp.queue)
+}
+
+// Purge drops all queued packets
+func (pp *PacketPacer) Purge() {
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+
+	for _, packet := range pp.queue {
+		if delivery := packet.getDelivery(); delivery != nil {
+			delivery.fail(ErrDeliveryConnectionClosed)
+		}
+	}
+
+	clear(pp.queue)
+	pp.queue = pp.queue[:0]
+
+	if pp.timer != nil {
+		pp.timer.Stop()
+		pp.timer = nil
+	}
+}
+
+// interval returns the time between packets. 0 means packets are not paced
+func (pp *PacketPacer) interval() time.Duration {
+	streamSettings := pp.connection.StreamSettings
+
+	if streamSettings.PacingRate == 0 {
+		return 0
+	}
+
+	interval := time.Second / time.Duration(streamSettings.PacingRate)
+
+	// * Sending faster than one window per round trip
+	// * only fills up the SlidingWindow queue
+	if rtt := pp.connection.rtt; rtt.Initialized() && streamSettings.WindowSize != 0 {
+		if rttInterval := rtt.Average() / time.Duration(streamSettings.WindowSize); rttInterval > interval {
+			interval = rttInterval
+		}
+	}
+
+	return interval
+}
+
+// flush sends as many queued packets as there are tokens for, and schedules the rest. Must be called with the mutex held
+func (pp *PacketPacer) flush() {
+	server := pp.connection.endpoint.Server
+	interval := pp.interval()
+
+	if interval == 0 {
+		for _, packet := range pp.queue {
+			server.sendPacket(packet)
+			packet.release()
+		}
+
+		clear(pp.queue)
+		pp.queue = pp.queue[:0]
+
+		return
+	}
+
+	burst := float64(max(pp.connection.StreamSettings.PacingBurst, 1))
+	now := time.Now()
+
+	pp.tokens = min(burst, pp.tokens+float64(now.Sub(pp.lastRefill))/float64(interval))
+	pp.lastRefill = now
+
+	for len(pp.queue) != 0 && pp.tokens >= 1 {
+		packet := pp.queue[0]
+		pp.queue[0] = nil
+		pp.queue = pp.queue[1:]
+		pp.tokens--
+
+		server.sendPacket(packet)
+		packet.release()
+	}
+
+	if len(pp.queue) != 0 && pp.timer == nil {
+		wait := time.Duration((1 - pp.tokens) * float64(interval))
+		pp.timer = time.AfterFunc(wait, pp.onTimer)
+	}
+}
+
+func (pp *PacketPacer) onTimer() {
+	// * Queued packets are sent under the connection lock,
+	// * like the ones sent right away by PRUDPServer.Send
+	pp.connection.Lock()
+	defer pp.connection.Unlock()
+
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+
+	pp.timer = nil
+	pp.flush()
+}
+
+// NewPacketPacer returns a new PacketPacer for the given connection
+func NewPacketPacer(connection *PRUDPConnection) *PacketPacer {
+	return &PacketPacer{
+		connection: connection,
+		queue:      make([]PRUDPPacketInterface, 0),
+		mutex:      &sync.Mutex{},
+	}
+}
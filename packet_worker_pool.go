@@ -0,0 +1,98 @@
+package nex
+
+import (
+	"hash/fnv"
+	"net"
+	"sync/atomic"
+)
+
+type packetJob struct {
+	packet PRUDPPacketInterface
+	socket *SocketConnection
+}
+
+// packetWorkerPool processes inbound packets on a fixed number of workers, each with a bounded queue.
+// Packets are sharded by the connection they belong to, so every packet from a connection is processed
+// in the order it was received, by the same worker. When a queue is full the packet is either dropped
+// or the socket reader waits for room, see PRUDPServer.BlockOnFullWorkerQueue
+type packetWorkerPool struct {
+	server  *PRUDPServer
+	queues  []chan packetJob
+	stop    chan struct{}
+	dropped atomic.Uint64
+	stalled atomic.Uint64
+}
+
+// queue hands a packet to the worker for its connection. Returns false if the packet was dropped
+func (pwp *packetWorkerPool) queue(packet PRUDPPacketInterface, socket *SocketConnection) bool {
+	job := packetJob{
+		packet: packet,
+		socket: socket,
+	}
+
+	queue := pwp.queues[pwp.shard(packet, socket.Address)]
+
+	select {
+	case queue <- job:
+		return true
+	default:
+	}
+
+	if !pwp.server.BlockOnFullWorkerQueue {
+		pwp.dropped.Add(1)
+		return false
+	}
+
+	pwp.stalled.Add(1)
+
+	select {
+	case queue <- job:
+		return true
+	case <-pwp.stop:
+		pwp.dropped.Add(1)
+		return false
+	}
+}
+
+// shard returns the worker for the connection a packet belongs to.
+// Uses the same values as the discriminator for the connection
+func (pwp *packetWorkerPool) shard(packet PRUDPPacketInterface, address net.Addr) int {
+	hash := fnv.New32a()
+
+	hash.Write([]byte(address.String()))
+	hash.Write([]byte{uint8(packet.SourceVirtualPortStreamType()), packet.SourceVirtualPortStreamID(), packet.DestinationVirtualPortStreamID()})
+
+	return int(hash.Sum32() % uint32(len(pwp.queues)))
+}
+
+func (pwp *packetWorkerPool) work(queue chan packetJob) {
+	for {
+		select {
+		case job := <-queue:
+			pwp.server.processPacket(job.packet, job.socket)
+			pwp.server.packetProcessed()
+		case <-pwp.stop:
+			return
+		}
+	}
+}
+
+// close stops all workers. Packets still queued are not processed
+func (pwp *packetWorkerPool) close() {
+	close(pwp.stop)
+}
+
+func newPacketWorkerPool(server *PRUDPServer, workers, queueSize int) *packetWorkerPool {
+	pwp := &packetWorkerPool{
+		server: server,
+		queues: make([]chan packetJob, workers),
+		stop:   make(chan struct{}),
+	}
+
+	for i := range pwp.queues {
+		pwp.queues[i] = make(chan packetJob, queueSize)
+		go pwp.work(pwp.queues[i])
+	}
+
+	return pwp
+}
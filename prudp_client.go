@@ -0,0 +1,616 @@
+package nex
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/PretendoNetwork/nex-go/v2/constants"
+	"github.com/PretendoNetwork/nex-go/v2/encryption"
+	"github.com/PretendoNetwork/nex-go/v2/types"
+	"github.com/lxzan/gws"
+)
+
+// PRUDPClient implements the client side of a PRUDP connection to a single remote PRUDPEndPoint.
+//
+// The client reuses the server side transport internally. Its connection lives on a private PRUDPEndPoint,
+// so reliable substreams, acknowledgements, fragmentation, retransmission and heartbeats behave identically
+// to connections made to a PRUDPServer. PRUDPv0 and PRUDPv1 connect over UDP, PRUDPLite connects over WebSocket
+type PRUDPClient struct {
+	Server              *PRUDPServer         // * Holds the packet settings, such as the access key and library versions. Never listens for connections
+	Endpoint            *PRUDPEndPoint       // * Local endpoint which owns the clients connection
+	PRUDPVersion        int                  // * 0 for PRUDPv0, 1 for PRUDPv1, 2 for PRUDPLite
+	StreamType          constants.StreamType // * rdv::Stream::Type of the remote endpoint
+	StreamID            uint8                // * Stream ID of the remote endpoint
+	MinorVersion        uint32               // * PRUDPv1/PRUDPLite minor version requested in the SYN packet
+	SupportedFunctions  uint32               // * PRUDPv1/PRUDPLite supported functions requested in the SYN packet
+	MaximumSubstreamID  uint8                // * PRUDPv1/PRUDPLite maximum substream ID requested in the SYN packet
+	kerberosTicket      *KerberosTicket
+	pid                 types.PID
+	stationCID          uint32
+	connection          *PRUDPConnection
+	webSocketConnection *gws.Conn
+	handshakePackets    chan PRUDPPacketInterface
+	callIDCounter       atomic.Uint32
+	pendingCalls        *MutexMap[uint32, chan *RMCMessage]
+	closed              chan struct{}
+	closeOnce           sync.Once
+}
+
+type prudpClientWebSocketHandler struct {
+	client *PRUDPClient
+}
+
+func (h *prudpClientWebSocketHandler) OnOpen(socket *gws.Conn) {}
+
+func (h *prudpClientWebSocketHandler) OnClose(socket *gws.Conn, _ error) {
+	// * The connection may have already been cleaned up by a DISCONNECT
+	if connection := h.client.connection; connection != nil && h.client.Endpoint.Connections.Size() != 0 {
+		h.client.Endpoint.CleanupConnection(connection)
+	}
+}
+
+func (h *prudpClientWebSocketHandler) OnPing(socket *gws.Conn, payload []byte) {
+	_ = socket.WritePong(nil)
+}
+
+func (h *prudpClientWebSocketHandler) OnPong(socket *gws.Conn, payload []byte) {}
+
+func (h *prudpClientWebSocketHandler) OnMessage(socket *gws.Conn, message *gws.Message) {
+	defer message.Close()
+
+	// * gws reuses the underlying buffer once the message is
+	// * closed, packets copy what they need while being decoded
+	h.client.handleSocketMessage(message.Bytes())
+}
+
+// SetKerberosTicket sets the ticket used to connect to a secure endpoint.
+//
+// The ticket is obtained from TicketGranting::RequestTicket. pid is the PID of the user the ticket
+// was issued to, and stationCID is the CID of the secure servers station URL
+func (c *PRUDPClient) SetKerberosTicket(ticket *KerberosTicket, pid types.PID, stationCID uint32) {
+	c.kerberosTicket = ticket
+	c.pid = pid
+	c.stationCID = stationCID
+}
+
+// Connection returns the clients PRUDPConnection. Nil until a connection has been attempted
+func (c *PRUDPClient) Connection() *PRUDPConnection {
+	return c.connection
+}
+
+// OnData adds an event handler which is fired when the remote endpoint sends an RMC request.
+// Responses to calls made with Call are not passed to these handlers
+func (c *PRUDPClient) OnData(handler func(packet PacketInterface)) {
+	c.Endpoint.OnData(func(packet PacketInterface) {
+		if message := packet.RMCMessage(); message != nil && message.IsRequest {
+			handler(packet)
+		}
+	})
+}
+
+// Dial opens a new UDP socket and connects to the PRUDP server at the given address, such as "127.0.0.1:60000"
+func (c *PRUDPClient) Dial(ctx context.Context, address string) error {
+	udpAddress, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return err
+	}
+
+	socket, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return err
+	}
+
+	err = c.ConnectUDP(ctx, socket, udpAddress)
+	if err != nil {
+		socket.Close()
+		return err
+	}
+
+	return nil
+}
+
+// ConnectUDP connects to the PRUDP server at the given address using the provided UDP socket.
+// The socket is closed when the client is closed
+func (c *PRUDPClient) ConnectUDP(ctx context.Context, socket net.PacketConn, address net.Addr) error {
+	if c.PRUDPVersion == 2 {
+		return errors.New("PRUDPLite connections must be made using ConnectWebSocket")
+	}
+
+	c.Server.udpSocket = socket
+
+	go c.listenDatagram(socket, address)
+
+	return c.connect(ctx, NewSocketConnection(c.Server, address, nil))
+}
+
+// ConnectWebSocket connects to the PRUDPLite server at the given WebSocket URL, such as "ws://127.0.0.1:60000"
+func (c *PRUDPClient) ConnectWebSocket(ctx context.Context, url string) error {
+	if c.PRUDPVersion != 2 {
+		return errors.New("Only PRUDPLite connections can be made using ConnectWebSocket")
+	}
+
+	// * PRUDPLite payloads are never encrypted, WSS is used instead
+	c.Endpoint.DefaultStreamSettings.EncryptionAlgorithm = encryption.NewDummyEncryption()
+
+	socket, _, err := gws.NewClient(&prudpClientWebSocketHandler{client: c}, &gws.ClientOption{
+		Addr:           url,
+		ReadBufferSize: 64000,
+	})
+	if err != nil {
+		return err
+	}
+
+	c.webSocketConnection = socket
+
+	go socket.ReadLoop()
+
+	err = c.connect(ctx, NewSocketConnection(c.Server, socket.RemoteAddr(), socket))
+	if err != nil {
+		socket.WriteClose(1000, nil)
+		return err
+	}
+
+	return nil
+}
+
+func (c *PRUDPClient) listenDatagram(socket net.PacketConn, address net.Addr) {
+	buffer := make([]byte, 64000)
+
+	for {
+		read, from, err := socket.ReadFrom(buffer)
+		if err != nil {
+			if !c.Server.shuttingDown.Load() {
+				logger.Error(err.Error())
+			}
+
+			return
+		}
+
+		// * Only the server we connected to can talk to us
+		if from.String() != address.String() {
+			continue
+		}
+
+		c.handleSocketMessage(buffer[:read])
+	}
+}
+
+func (c *PRUDPClient) handleSocketMessage(packetData []byte) {
+	readStream := getByteStreamIn(packetData, c.Server.LibraryVersions, c.Server.ByteStreamSettings)
+
+	var packets []PRUDPPacketInterface
+
+	switch c.PRUDPVersion {
+	case 0:
+		packets, _ = NewPRUDPPacketsV0(c.Server, nil, readStream)
+	case 1:
+		packets, _ = NewPRUDPPacketsV1(c.Server, nil, readStream)
+	case 2:
+		packets, _ = NewPRUDPPacketsLite(c.Server, nil, readStream)
+	}
+
+	putByteStreamIn(readStream)
+
+	for _, packet := range packets {
+		// * The handshake is driven by connect, everything
+		// * else is handled the same way a server would
+		if packet.HasFlag(constants.PacketFlagAck) && (packet.Type() == constants.SynPacket || packet.Type() == constants.ConnectPacket) {
+			select {
+			case c.handshakePackets <- packet:
+			default:
+			}
+
+			continue
+		}
+
+		if c.connection != nil {
+			c.Endpoint.processPacket(packet, c.connection.Socket)
+		}
+	}
+}
+
+func (c *PRUDPClient) connect(ctx context.Context, socket *SocketConnection) error {
+	connection := NewPRUDPConnection(socket)
+	connection.endpoint = c.Endpoint
+	connection.ID = c.Endpoint.ConnectionIDCounter.Next()
+	connection.DefaultPRUDPVersion = c.PRUDPVersion
+	connection.StreamType = c.StreamType
+	connection.StreamID = c.StreamID
+	connection.StreamSettings = c.Endpoint.DefaultStreamSettings.Copy()
+	connection.ConnectionState = StateConnecting
+
+	c.connection = connection
+
+	// * Packets from the server use the servers virtual port as their
+	// * source, so this is the discriminator the endpoint will look for
+	discriminator := fmt.Sprintf("%s-%d-%d", socket.Address.String(), c.StreamType, c.StreamID)
+	c.Endpoint.Connections.Set(discriminator, connection)
+
+	err := c.handshake(ctx)
+	if err != nil {
+		c.Endpoint.CleanupConnection(connection)
+		return err
+	}
+
+	return nil
+}
+
+func (c *PRUDPClient) handshake(ctx context.Context) error {
+	connection := c.connection
+
+	syn := c.newPacket(constants.SynPacket)
+	syn.AddFlag(constants.PacketFlagNeedsAck)
+
+	switch syn := syn.(type) {
+	case *PRUDPPacketV0:
+		syn.SetConnectionSignature(make([]byte, 4))
+	case *PRUDPPacketV1:
+		syn.SetConnectionSignature(make([]byte, 16))
+	}
+
+	syn.SetSignature(syn.CalculateSignature([]byte{}, []byte{}))
+
+	synAck, err := c.sendHandshakePacket(ctx, syn)
+	if err != nil {
+		return fmt.Errorf("Failed to send SYN. %s", err.Error())
+	}
+
+	// * The server expects our packets to be signed using the
+	// * signature it sent us, and will sign its own packets
+	// * using the signature we send in the CONNECT packet
+	serverConnectionSignature := synAck.GetConnectionSignature()
+	clientConnectionSignature := make([]byte, len(serverConnectionSignature))
+	sessionID := make([]byte, 1)
+
+	if _, err := rand.Read(clientConnectionSignature); err != nil {
+		return err
+	}
+
+	if _, err := rand.Read(sessionID); err != nil {
+		return err
+	}
+
+	connect := c.newPacket(constants.ConnectPacket)
+	connect.AddFlag(constants.PacketFlagReliable)
+	connect.AddFlag(constants.PacketFlagNeedsAck)
+	connect.SetSessionID(sessionID[0])
+	connect.SetSequenceID(1)
+	connect.SetConnectionSignature(clientConnectionSignature)
+
+	switch connect := connect.(type) {
+	case *PRUDPPacketV1:
+		synAck := synAck.(*PRUDPPacketV1)
+
+		// * Send back what the server agreed to support
+		connect.MinorVersion = synAck.MinorVersion
+		connect.SupportedFunctions = synAck.SupportedFunctions
+		connect.MaximumSubstreamID = synAck.MaximumSubstreamID
+	case *PRUDPPacketLite:
+		connect.liteSignature = clientConnectionSignature
+	}
+
+	var checkValue uint32
+
+	if c.kerberosTicket != nil {
+		checkValueBytes := make([]byte, 4)
+		if _, err := rand.Read(checkValueBytes); err != nil {
+			return err
+		}
+
+		checkValue = binary.LittleEndian.Uint32(checkValueBytes)
+
+		payload, err := c.encodeConnectPayload(connection, c.kerberosConnectPayload(checkValue))
+		if err != nil {
+			return fmt.Errorf("Failed to encode CONNECT payload. %s", err.Error())
+		}
+
+		connect.SetPayload(payload)
+	}
+
+	connect.SetSignature(connect.CalculateSignature([]byte{}, serverConnectionSignature))
+
+	connectAck, err := c.sendHandshakePacket(ctx, connect)
+	if err != nil {
+		return fmt.Errorf("Failed to send CONNECT. %s", err.Error())
+	}
+
+	if c.kerberosTicket != nil {
+		responseCheckValue, err := c.decodeConnectResponse(connection, connectAck.Payload())
+		if err != nil {
+			return fmt.Errorf("Failed to decode CONNECT response. %s", err.Error())
+		}
+
+		if responseCheckValue != checkValue+1 {
+			return fmt.Errorf("Invalid CONNECT response check value. Expected %d, got %d", checkValue+1, responseCheckValue)
+		}
+	}
+
+	connection.Lock()
+	defer connection.Unlock()
+
+	connection.Signature = clientConnectionSignature
+	connection.ServerConnectionSignature = serverConnectionSignature
+	connection.SessionID = connectAck.SessionID()
+	connection.ServerSessionID = sessionID[0]
+
+	var maximumSubstreamID uint8
+
+	switch connectAck := connectAck.(type) {
+	case *PRUDPPacketV1:
+		maximumSubstreamID = connectAck.MaximumSubstreamID
+		connection.MinorVersion = connectAck.MinorVersion
+		connection.SupportedFunctions = connectAck.SupportedFunctions
+	case *PRUDPPacketLite:
+		connection.MinorVersion = connectAck.minorVersion
+		connection.SupportedFunctions = connectAck.supportedFunctions
+	}
+
+	connection.InitializeSlidingWindows(maximumSubstreamID)
+	connection.InitializePacketDispatchQueues(maximumSubstreamID)
+
+	// * Our CONNECT packet used sequence ID 1, so our first
+	// * DATA packet is 2. The servers CONNECT ACK does not
+	// * use a reliable sequence ID, so its first DATA is 1
+	connection.slidingWindows.Each(func(_ uint8, slidingWindow *SlidingWindow) bool {
+		slidingWindow.sequenceIDCounter = NewCounter[uint16](1)
+		return false
+	})
+
+	connection.packetDispatchQueues.Each(func(_ uint8, packetDispatchQueue *PacketDispatchQueue) bool {
+		packetDispatchQueue.nextExpectedSequenceId = NewCounter[uint16](1)
+		return false
+	})
+
+	if c.kerberosTicket != nil {
+		connection.SetPID(c.pid)
+		connection.SetSessionKey(c.kerberosTicket.SessionKey)
+	}
+
+	connection.ConnectionState = StateConnected
+	connection.StartHeartbeat()
+
+	return nil
+}
+
+// sendHandshakePacket sends a SYN or CONNECT packet until the server acknowledges it or the context is done
+func (c *PRUDPClient) sendHandshakePacket(ctx context.Context, packet PRUDPPacketInterface) (PRUDPPacketInterface, error) {
+	streamSettings := c.connection.StreamSettings
+	retransmitTimeout := time.Duration(streamSettings.SynInitialRTT) * time.Millisecond
+	data := packet.Bytes()
+
+	for sendCount := uint32(0); sendCount <= streamSettings.MaxPacketRetransmissions; sendCount++ {
+		c.Server.SendRaw(c.connection.Socket, data)
+
+		timer := time.NewTimer(retransmitTimeout)
+
+	waitForAck:
+		for {
+			select {
+			case ack := <-c.handshakePackets:
+				// * Ignore duplicate ACKs from earlier packets
+				if ack.Type() == packet.Type() {
+					timer.Stop()
+					return ack, nil
+				}
+			case <-timer.C:
+				break waitForAck
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	return nil, NewError(ResultCodes.Transport.Timeout, "Server did not acknowledge the packet")
+}
+
+// kerberosConnectPayload builds the payload read by PRUDPEndPoint.ReadKerberosTicket
+func (c *PRUDPClient) kerberosConnectPayload(checkValue uint32) []byte {
+	requestDataStream := NewByteStreamOut(c.Server.LibraryVersions, c.Server.ByteStreamSettings)
+
+	c.pid.WriteTo(requestDataStream)
+	requestDataStream.WriteUInt32LE(c.stationCID)
+	requestDataStream.WriteUInt32LE(checkValue)
+
+	kerberos := NewKerberosEncryption(c.kerberosTicket.SessionKey)
+
+	ticketData := types.NewBuffer(c.kerberosTicket.InternalData)
+	requestData := types.NewBuffer(kerberos.Encrypt(requestDataStream.Bytes()))
+
+	stream := NewByteStreamOut(c.Server.LibraryVersions, c.Server.ByteStreamSettings)
+
+	ticketData.WriteTo(stream)
+	requestData.WriteTo(stream)
+
+	return stream.Bytes()
+}
+
+func (c *PRUDPClient) encodeConnectPayload(connection *PRUDPConnection, payload []byte) ([]byte, error) {
+	compressedPayload, err := connection.StreamSettings.CompressionAlgorithm.Compress(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.Server.PRUDPV0Settings.EncryptedConnect {
+		return compressedPayload, nil
+	}
+
+	return connection.StreamSettings.EncryptionAlgorithm.Encrypt(compressedPayload)
+}
+
+func (c *PRUDPClient) decodeConnectResponse(connection *PRUDPConnection, payload []byte) (uint32, error) {
+	var err error
+
+	if c.Server.PRUDPV0Settings.EncryptedConnect {
+		payload, err = connection.StreamSettings.EncryptionAlgorithm.Decrypt(payload)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	payload, err = connection.StreamSettings.CompressionAlgorithm.Decompress(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	checkValueResponse := types.NewBuffer(nil)
+	if err := checkValueResponse.ExtractFrom(NewByteStreamIn(payload, c.Server.LibraryVersions, c.Server.ByteStreamSettings)); err != nil {
+		return 0, err
+	}
+
+	if len(checkValueResponse) != 4 {
+		return 0, fmt.Errorf("Invalid check value size %d", len(checkValueResponse))
+	}
+
+	return binary.LittleEndian.Uint32(checkValueResponse), nil
+}
+
+func (c *PRUDPClient) newPacket(packetType uint16) PRUDPPacketInterface {
+	var packet PRUDPPacketInterface
+
+	switch c.PRUDPVersion {
+	case 0:
+		packet, _ = NewPRUDPPacketV0(c.Server, c.connection, nil)
+	case 1:
+		v1Packet, _ := NewPRUDPPacketV1(c.Server, c.connection, nil)
+		v1Packet.MinorVersion = c.MinorVersion
+		v1Packet.SupportedFunctions = c.SupportedFunctions
+		v1Packet.MaximumSubstreamID = c.MaximumSubstreamID
+		packet = v1Packet
+	case 2:
+		litePacket, _ := NewPRUDPPacketLite(c.Server, c.connection, nil)
+		litePacket.minorVersion = c.MinorVersion
+		litePacket.supportedFunctions = c.SupportedFunctions
+		litePacket.maximumSubstreamID = c.MaximumSubstreamID
+		packet = litePacket
+	}
+
+	packet.SetType(packetType)
+	packet.SetSourceVirtualPortStreamType(c.StreamType)
+	packet.SetSourceVirtualPortStreamID(c.Endpoint.StreamID)
+	packet.SetDestinationVirtualPortStreamType(c.StreamType)
+	packet.SetDestinationVirtualPortStreamID(c.StreamID)
+
+	return packet
+}
+
+// Call sends an RMC request to the remote endpoint and waits for the response with the matching call ID.
+// Calls may be made from several goroutines at once. Server.Send queues every fragment of a request
+// together, so fragments of different requests are never interleaved
+//
+// If the server responds with an error, the response is returned along with an *Error holding the result code
+func (c *PRUDPClient) Call(ctx context.Context, protocolID uint16, methodID uint32, parameters []byte) (*RMCMessage, error) {
+	if c.connection == nil {
+		return nil, NewError(ResultCodes.RendezVous.NotAuthenticated, "Client is not connected")
+	}
+
+	// * The state is changed by the endpoint while
+	// * the connection is locked, such as on a DISCONNECT
+	c.connection.Lock()
+	connectionState := c.connection.ConnectionState
+	c.connection.Unlock()
+
+	if connectionState != StateConnected {
+		return nil, NewError(ResultCodes.RendezVous.NotAuthenticated, "Client is not connected")
+	}
+
+	request := NewRMCRequest(c.Endpoint)
+	request.ProtocolID = protocolID
+	request.MethodID = methodID
+	request.CallID = c.callIDCounter.Add(1)
+	request.Parameters = parameters
+
+	response := make(chan *RMCMessage, 1)
+
+	c.pendingCalls.Set(request.CallID, response)
+	defer c.pendingCalls.Delete(request.CallID)
+
+	packet := c.newPacket(constants.DataPacket)
+	packet.AddFlag(constants.PacketFlagReliable)
+	packet.AddFlag(constants.PacketFlagNeedsAck)
+	packet.SetSubstreamID(0)
+	packet.SetPayload(request.Bytes())
+
+	if packet.Version() == 0 {
+		packet.AddFlag(constants.PacketFlagHasSize)
+	}
+
+	c.Server.Send(packet)
+
+	select {
+	case message := <-response:
+		if !message.IsSuccess {
+			return message, NewError(message.ErrorCode, fmt.Sprintf("RMC call to protocol %d method %d failed", protocolID, methodID))
+		}
+
+		return message, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.closed:
+		return nil, NewError(ResultCodes.RendezVous.ConnectionDisconnected, "Connection closed before a response was received")
+	}
+}
+
+func (c *PRUDPClient) handleData(packet PacketInterface) {
+	message := packet.RMCMessage()
+	if message == nil || message.IsRequest {
+		return
+	}
+
+	if response, ok := c.pendingCalls.Get(message.CallID); ok {
+		select {
+		case response <- message:
+		default:
+		}
+	}
+}
+
+// Done returns a channel which is closed once the connection has ended
+func (c *PRUDPClient) Done() <-chan struct{} {
+	return c.closed
+}
+
+// Close sends a DISCONNECT packet to the remote endpoint and closes the underlying socket
+func (c *PRUDPClient) Close() error {
+	err := c.Server.Shutdown(context.Background())
+
+	if c.webSocketConnection != nil {
+		c.webSocketConnection.WriteClose(1000, nil)
+	}
+
+	return err
+}
+
+// NewPRUDPClient returns a new PRUDPClient which connects to the PRUDPEndPoint on the given stream ID using the given PRUDP version
+func NewPRUDPClient(prudpVersion int, streamID uint8) *PRUDPClient {
+	c := &PRUDPClient{
+		Server:             NewPRUDPServer(),
+		Endpoint:           NewPRUDPEndPoint(15), // * Clients start at stream ID 15
+		PRUDPVersion:       prudpVersion,
+		StreamType:         constants.StreamTypeRVSecure,
+		StreamID:           streamID,
+		MaximumSubstreamID: 0,
+		MinorVersion:       0,
+		handshakePackets:   make(chan PRUDPPacketInterface, 8),
+		pendingCalls:       NewMutexMap[uint32, chan *RMCMessage](),
+		closed:             make(chan struct{}),
+	}
+
+	c.Server.BindPRUDPEndPoint(c.Endpoint)
+
+	c.Endpoint.OnData(c.handleData)
+	c.Endpoint.OnConnectionEnded(func(_ *PRUDPConnection) {
+		c.closeOnce.Do(func() {
+			close(c.closed)
+		})
+	})
+
+	return c
+}
@@ -0,0 +1,223 @@
+package nex
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/PretendoNetwork/nex-go/v2/constants"
+	"github.com/PretendoNetwork/nex-go/v2/encryption"
+	"github.com/PretendoNetwork/nex-go/v2/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	testServerAccount = NewAccount(types.NewPID(2), "Quazal Rendez-Vous", "securepassword", false)
+	testUserAccount   = NewAccount(types.NewPID(1800000000), "1800000000", "nexuserpassword", false)
+)
+
+func testAccountDetailsByPID(pid types.PID) (*Account, *Error) {
+	if pid.Equals(testUserAccount.PID) {
+		return testUserAccount, nil
+	}
+
+	return testServerAccount, nil
+}
+
+func testAccountDetailsByUsername(username string) (*Account, *Error) {
+	if username == testUserAccount.Username {
+		return testUserAccount, nil
+	}
+
+	return testServerAccount, nil
+}
+
+func newTestResponsePacket(server *PRUDPServer, request PRUDPPacketInterface, payload []byte) PRUDPPacketInterface {
+	var packet PRUDPPacketInterface
+
+	connection := request.Sender().(*PRUDPConnection)
+
+	switch request.Version() {
+	case 0:
+		packet, _ = NewPRUDPPacketV0(server, connection, nil)
+		packet.AddFlag(constants.PacketFlagHasSize)
+	case 1:
+		packet, _ = NewPRUDPPacketV1(server, connection, nil)
+	default:
+		packet, _ = NewPRUDPPacketLite(server, connection, nil)
+	}
+
+	packet.SetType(constants.DataPacket)
+	packet.AddFlag(constants.PacketFlagReliable)
+	packet.AddFlag(constants.PacketFlagNeedsAck)
+	packet.SetSourceVirtualPortStreamType(request.DestinationVirtualPortStreamType())
+	packet.SetSourceVirtualPortStreamID(request.DestinationVirtualPortStreamID())
+	packet.SetDestinationVirtualPortStreamType(request.SourceVirtualPortStreamType())
+	packet.SetDestinationVirtualPortStreamID(request.SourceVirtualPortStreamID())
+	packet.SetSubstreamID(request.SubstreamID())
+	packet.SetPayload(payload)
+
+	return packet
+}
+
+// newTestEchoServer creates a server which responds to every RMC request with its own parameters
+func newTestEchoServer(secure bool) (*PRUDPServer, *PRUDPEndPoint) {
+	server := NewPRUDPServer()
+	endpoint := NewPRUDPEndPoint(1)
+
+	endpoint.AccountDetailsByPID = testAccountDetailsByPID
+	endpoint.AccountDetailsByUsername = testAccountDetailsByUsername
+	endpoint.ServerAccount = testServerAccount
+	endpoint.IsSecureEndPoint = secure
+
+	endpoint.OnData(func(packet PacketInterface) {
+		request := packet.RMCMessage()
+
+		response := NewRMCSuccess(endpoint, request.Parameters)
+		response.ProtocolID = request.ProtocolID
+		response.MethodID = request.MethodID
+		response.CallID = request.CallID
+
+		server.Send(newTestResponsePacket(server, packet.(PRUDPPacketInterface), response.Bytes()))
+	})
+
+	server.SessionKeyLength = 16
+	server.AccessKey = "ridfebb9"
+
+	server.BindPRUDPEndPoint(endpoint)
+
+	return server, endpoint
+}
+
+func newTestKerberosTicket(server *PRUDPServer) *KerberosTicket {
+	targetKey := DeriveKerberosKey(testServerAccount.PID, []byte(testServerAccount.Password))
+	sessionKey := make([]byte, server.SessionKeyLength)
+
+	ticketInternalData := NewKerberosTicketInternalData(server)
+	ticketInternalData.Issued = types.NewDateTime(0).Now()
+	ticketInternalData.SourcePID = testUserAccount.PID
+	ticketInternalData.SessionKey = sessionKey
+
+	encryptedTicketInternalData, _ := ticketInternalData.Encrypt(targetKey, NewByteStreamOut(server.LibraryVersions, server.ByteStreamSettings))
+
+	ticket := NewKerberosTicket()
+	ticket.SessionKey = sessionKey
+	ticket.TargetPID = testServerAccount.PID
+	ticket.InternalData = types.NewBuffer(encryptedTicketInternalData)
+
+	return ticket
+}
+
+func TestPRUDPClientCall(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		prudpVersion int
+		secure       bool
+	}{
+		{"PRUDPv0", 0, false},
+		{"PRUDPv0 secure", 0, true},
+		{"PRUDPv1", 1, false},
+		{"PRUDPv1 secure", 1, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server, _ := newTestEchoServer(test.secure)
+
+			serverSocket, err := net.ListenPacket("udp", "127.0.0.1:0")
+			assert.NoError(t, err)
+
+			go server.ServeUDP(serverSocket)
+			defer server.Shutdown(context.Background())
+
+			client := NewPRUDPClient(test.prudpVersion, 1)
+			client.Server.AccessKey = server.AccessKey
+
+			if test.secure {
+				client.SetKerberosTicket(newTestKerberosTicket(server), testUserAccount.PID, 1)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			assert.NoError(t, client.Dial(ctx, serverSocket.LocalAddr().String()))
+			defer client.Close()
+
+			response, err := client.Call(ctx, 0x64, 1, []byte("ping"))
+			assert.NoError(t, err)
+
+			if assert.NotNil(t, response) {
+				assert.Equal(t, []byte("ping"), response.Parameters)
+			}
+		})
+	}
+}
+
+func TestPRUDPClientConcurrentCalls(t *testing.T) {
+	server, _ := newTestEchoServer(false)
+
+	serverSocket, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	go server.ServeUDP(serverSocket)
+	defer server.Shutdown(context.Background())
+
+	client := NewPRUDPClient(1, 1)
+	client.Server.AccessKey = server.AccessKey
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	assert.NoError(t, client.Dial(ctx, serverSocket.LocalAddr().String()))
+	defer client.Close()
+
+	// * Large enough to be fragmented, so interleaved fragments would corrupt the messages
+	errs := make(chan error, 8)
+
+	for i := 0; i < cap(errs); i++ {
+		go func(i int) {
+			parameters := bytes.Repeat([]byte{byte(i)}, 4000)
+
+			response, err := client.Call(ctx, 0x64, 1, parameters)
+			if err == nil && !bytes.Equal(parameters, response.Parameters) {
+				err = assert.AnError
+			}
+
+			errs <- err
+		}(i)
+	}
+
+	for i := 0; i < cap(errs); i++ {
+		assert.NoError(t, <-errs)
+	}
+}
+
+func TestPRUDPClientCallLite(t *testing.T) {
+	server, endpoint := newTestEchoServer(true)
+
+	// * The server does not skip encryption for PRUDPLite on its own
+	endpoint.DefaultStreamSettings.EncryptionAlgorithm = encryption.NewDummyEncryption()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	go server.ServeWebSocket(listener)
+	defer server.Shutdown(context.Background())
+
+	client := NewPRUDPClient(2, 1)
+	client.Server.AccessKey = server.AccessKey
+	client.SetKerberosTicket(newTestKerberosTicket(server), testUserAccount.PID, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, client.ConnectWebSocket(ctx, "ws://"+listener.Addr().String()))
+	defer client.Close()
+
+	response, err := client.Call(ctx, 0x64, 1, []byte("ping"))
+	assert.NoError(t, err)
+
+	if assert.NotNil(t, response) {
+		assert.Equal(t, []byte("ping"), response.Parameters)
+	}
+}
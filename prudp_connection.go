@@ -6,6 +6,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/PretendoNetwork/nex-go/v2/compression"
 	"github.com/PretendoNetwork/nex-go/v2/constants"
 	"github.com/PretendoNetwork/nex-go/v2/types"
 )
@@ -23,6 +24,8 @@ type PRUDPConnection struct {
 	SessionKey                          []byte                                 // * Secret key generated at the start of the session. Used for encrypting packets to the secure server
 	pid                                 types.PID                              // * PID of the user
 	DefaultPRUDPVersion                 int                                    // * The PRUDP version the connection was established with. Used for sending PING packets
+	MinorVersion                        uint32                                 // * The PRUDP minor version negotiated during the handshake. PRUDPv1 and PRUDPLite only
+	SupportedFunctions                  uint32                                 // * The PRUDP functions negotiated during the handshake. PRUDPv1 and PRUDPLite only
 	StreamType                          constants.StreamType                   // * rdv::Stream::Type used in this connection
 	StreamID                            uint8                                  // * rdv::Stream ID, also called the "port number", used in this connection. 0-15 on PRUDPv0/v1, and 0-31 on PRUDPLite
 	StreamSettings                      *StreamSettings                        // * Settings for this virtual connection
@@ -33,11 +36,19 @@ type PRUDPConnection struct {
 	slidingWindows                      *MutexMap[uint8, *SlidingWindow]       // * Outbound reliable packet substreams
 	packetDispatchQueues                *MutexMap[uint8, *PacketDispatchQueue] // * Inbound reliable packet substreams
 	incomingFragmentBuffers             *MutexMap[uint8, []byte]               // * Buffers which store the incoming payloads from fragmented DATA packets
+	unreliableReassembler               *UnreliablePacketReassembler           // * Rebuilds fragmented unreliable DATA messages
+	pacer                               *PacketPacer                           // * Spaces out outgoing DATA packets
+	dataDispatcher                      *DataDispatcher                        // * Runs the DATA event handlers outside of the connection lock
+	pendingAcknowledgements             map[uint8][]uint16                     // * Sequence IDs waiting to be sent in an aggregate ACK, by substream
+	acknowledgementTimer                *wheelTimer
 	OutgoingUnreliableSequenceIDCounter *Counter[uint16]
 	outgoingPingSequenceIDCounter       *Counter[uint16]
 	lastSentPingTime                    time.Time
-	heartbeatTimer                      *time.Timer
-	pingKickTimer                       *time.Timer
+	timerWheel                          *timerWheel // * Runs the retransmission, acknowledgement, heartbeat and handshake timers of the connection
+	heartbeatTimer                      *wheelTimer
+	pingKickTimer                       *wheelTimer
+	handshakeTimer                      *wheelTimer
+	halfOpen                            bool // * Whether the connection is counted as half-open by the server
 	StationURLs                         types.List[types.StationURL]
 	mutex                               *sync.Mutex
 }
@@ -70,9 +81,24 @@ func (pc *PRUDPConnection) Reset() {
 	})
 
 	pc.slidingWindows.Clear(func(_ uint8, slidingWindow *SlidingWindow) {
-		slidingWindow.TimeoutManager.Stop()
+		slidingWindow.Stop()
 	})
 
+	pc.pacer.Purge()
+	pc.unreliableReassembler.Purge()
+
+	if pc.acknowledgementTimer != nil {
+		pc.acknowledgementTimer.stop()
+		pc.acknowledgementTimer = nil
+	}
+
+	clear(pc.pendingAcknowledgements)
+
+	if pc.endpoint != nil {
+		pc.dataDispatcher.Purge()
+		pc.endpoint.uncountConnection(pc)
+	}
+
 	pc.Signature = make([]byte, 0)
 	pc.ServerConnectionSignature = make([]byte, 0)
 	pc.SessionKey = make([]byte, 0)
@@ -85,6 +111,7 @@ func (pc *PRUDPConnection) cleanup() {
 	pc.Reset()
 
 	pc.stopHeartbeatTimers()
+	pc.endHandshake()
 
 	pc.endpoint.emitConnectionEnded(pc)
 }
@@ -116,6 +143,10 @@ func (pc *PRUDPConnection) CreateSlidingWindow(substreamID uint8) *SlidingWindow
 	slidingWindow.sequenceIDCounter = NewCounter[uint16](0) // * First DATA packet from the server has sequence ID 1 (start counter at 0 and is incremeneted)
 	slidingWindow.streamSettings = pc.StreamSettings.Copy()
 
+	// * Resends follow the settings of the connection, such as MaxPacketRetransmissions
+	// * and RTTRetransmit, rather than the defaults the TimeoutManager was created with
+	slidingWindow.TimeoutManager.streamSettings = slidingWindow.streamSettings
+
 	pc.slidingWindows.Set(substreamID, slidingWindow)
 
 	return slidingWindow
@@ -138,6 +169,8 @@ func (pc *PRUDPConnection) SlidingWindow(substreamID uint8) *SlidingWindow {
 // CreatePacketDispatchQueue creates a new PacketDispatchQueue for the given substream and returns it
 func (pc *PRUDPConnection) CreatePacketDispatchQueue(substreamID uint8) *PacketDispatchQueue {
 	pdq := NewPacketDispatchQueue()
+	pdq.streamSettings = pc.StreamSettings
+
 	pc.packetDispatchQueues.Set(substreamID, pdq)
 	return pdq
 }
@@ -200,12 +233,12 @@ func (pc *PRUDPConnection) SetSessionKey(sessionKey []byte) {
 // ResetHeartbeat resets the connection's heartbeat timer to PRUDPConnection.StreamSettings.MaxSilenceTime.
 func (pc *PRUDPConnection) ResetHeartbeat() {
 	if pc.pingKickTimer != nil {
-		pc.pingKickTimer.Stop()
+		pc.pingKickTimer.stop()
 	}
 
 	if pc.heartbeatTimer != nil {
 		// TODO: This may not be accurate, needs more research
-		pc.heartbeatTimer.Reset(time.Duration(pc.StreamSettings.MaxSilenceTime) * time.Millisecond)
+		pc.heartbeatTimer.reset(time.Duration(pc.StreamSettings.MaxSilenceTime) * time.Millisecond)
 	}
 }
 
@@ -251,34 +284,190 @@ func (pc *PRUDPConnection) StartHeartbeat() {
 	// TODO: This may not be accurate, needs more research
 	maxSilenceTime := time.Duration(pc.StreamSettings.MaxSilenceTime) * time.Millisecond
 
+	pc.stopHeartbeatTimers()
+
+	// * If the heartbeat still did not restart after
+	// * the PING, assume the connection is dead and
+	// * clean up. Run on its own goroutine, since it
+	// * emits events and the wheel must not block
+	pc.pingKickTimer = newWheelTimer(pc.timerWheel, func() {
+		go endpoint.kickSilentConnection(pc)
+	})
+
 	// * Every time a packet is sent, connection.resetHeartbeat()
 	// * is called which resets this timer. If this function
 	// * ever executes, it means we haven't seen the client
 	// * in the expected time frame. If this happens, send
 	// * the client a PING packet to try and kick start the
-	// * heartbeat again
-	pc.heartbeatTimer = time.AfterFunc(maxSilenceTime, func() {
-		endpoint.sendPing(pc)
-
-		// * If the heartbeat still did not restart, assume the
-		// * connection is dead and clean up
-		pc.pingKickTimer = time.AfterFunc(maxSilenceTime, func() {
-			endpoint.CleanupConnection(pc)
-		})
+	// * heartbeat again. Sending may block on the socket, so
+	// * it is also run on its own goroutine
+	pc.heartbeatTimer = newWheelTimer(pc.timerWheel, func() {
+		go endpoint.sendPing(pc)
+		pc.pingKickTimer.reset(maxSilenceTime)
+	})
+
+	pc.heartbeatTimer.reset(maxSilenceTime)
+}
+
+// startHandshakeTimer removes the connection if it does not complete the handshake within StreamSettings.HandshakeTimeout
+func (pc *PRUDPConnection) startHandshakeTimer() {
+	if pc.handshakeTimer != nil {
+		pc.handshakeTimer.stop()
+		pc.handshakeTimer = nil
+	}
+
+	if pc.StreamSettings.HandshakeTimeout == 0 {
+		return
+	}
+
+	endpoint := pc.endpoint
+	timeout := time.Duration(pc.StreamSettings.HandshakeTimeout) * time.Millisecond
+
+	var timer *wheelTimer
+
+	// * Run on its own goroutine, since it takes
+	// * the connection lock and the wheel must not block
+	timer = newWheelTimer(pc.timerWheel, func() {
+		go func() {
+			pc.Lock()
+			defer pc.Unlock()
+
+			// * Checked under the lock, so a handshake which completes or restarts
+			// * while the timer fires doesn't have its connection removed
+			if pc.handshakeTimer == timer && pc.ConnectionState != StateConnected {
+				endpoint.CleanupConnection(pc)
+			}
+		}()
 	})
+
+	pc.handshakeTimer = timer
+	timer.reset(timeout)
+}
+
+// endHandshake stops the handshake timer and stops counting the connection as half-open.
+// Called once the handshake is complete, or when the connection is removed
+func (pc *PRUDPConnection) endHandshake() {
+	if pc.handshakeTimer != nil {
+		pc.handshakeTimer.stop()
+		pc.handshakeTimer = nil
+	}
+
+	if pc.halfOpen {
+		pc.endpoint.Server.halfOpenConnections.remove(pc.endpoint, pc.Socket.Address)
+		pc.halfOpen = false
+	}
+}
+
+// usesNewAggregateAckFormat returns whether aggregate ACKs sent to this connection should use the format which
+// supports every substream. PRUDPv0, and PRUDPv1 before minor version 2, only support aggregate ACKs on substream 0
+func (pc *PRUDPConnection) usesNewAggregateAckFormat() bool {
+	return pc.DefaultPRUDPVersion == 2 || (pc.DefaultPRUDPVersion == 1 && pc.MinorVersion >= 2)
+}
+
+// FragmentSize returns the max payload size of the DATA packets sent to this connection.
+// Uses the endpoints CalcFragmentSizeCallback if set. Otherwise, when the server has an MTU set,
+// the size is derived from the MTU by removing the transport, PRUDP header and compression overhead.
+// Falls back to the servers FragmentSize if no MTU is set, or if the MTU is too small
+func (pc *PRUDPConnection) FragmentSize() int {
+	if pc.endpoint.CalcFragmentSizeCallback != nil {
+		if fragmentSize := pc.endpoint.CalcFragmentSizeCallback(pc); fragmentSize > 0 {
+			return fragmentSize
+		}
+	}
+
+	server := pc.endpoint.Server
+
+	if server.MTU == 0 {
+		return server.FragmentSize
+	}
+
+	available := server.MTU - pc.transportOverhead() - pc.packetOverhead()
+
+	// * The compression header and worst case expansion
+	// * are added to every fragment after it is split
+	switch pc.StreamSettings.CompressionAlgorithm.(type) {
+	case *compression.Zlib:
+		// * Ratio byte, zlib header and checksum and a stored deflate block header
+		available -= 12
+	case *compression.LZO:
+		// * Ratio byte and LZO1X's worst case expansion of n/16+67 bytes
+		available = (available - 68) * 16 / 17
+	}
+
+	if available <= 0 {
+		return server.FragmentSize
+	}
+
+	return available
+}
+
+// transportOverhead returns the size of the IP, UDP or TCP and WebSocket headers wrapping each packet
+func (pc *PRUDPConnection) transportOverhead() int {
+	var ip net.IP
+
+	switch v := pc.Socket.Address.(type) {
+	case *net.UDPAddr:
+		ip = v.IP
+	case *net.TCPAddr:
+		ip = v.IP
+	}
+
+	ipHeaderSize := 20
+
+	if ip != nil && ip.To4() == nil {
+		ipHeaderSize = 40
+	}
+
+	if pc.Socket.WebSocketConnection != nil {
+		// * TCP header and a binary WebSocket frame header
+		return ipHeaderSize + 20 + 8
+	}
+
+	// * UDP header
+	return ipHeaderSize + 8
+}
+
+// packetOverhead returns the size of the PRUDP header of a fragmented DATA packet sent to this connection
+func (pc *PRUDPConnection) packetOverhead() int {
+	switch pc.DefaultPRUDPVersion {
+	case 0:
+		settings := pc.endpoint.Server.PRUDPV0Settings
+
+		// * Source, destination, type and flags, session ID, signature,
+		// * sequence ID, fragment ID, payload size and checksum
+		overhead := 15
+
+		if settings.IsQuazalMode {
+			overhead-- // * Type and flags are packed into 1 byte
+		}
+
+		if settings.UseEnhancedChecksum {
+			overhead += 3
+		}
+
+		return overhead
+	case 1:
+		// * Magic, header, signature and the fragment ID option
+		return 2 + 12 + 16 + 3
+	default:
+		// * Magic, header, stream types and ports, fragment ID and sequence ID
+		return 12
+	}
 }
 
 func (pc *PRUDPConnection) stopHeartbeatTimers() {
 	if pc.pingKickTimer != nil {
-		pc.pingKickTimer.Stop()
+		pc.pingKickTimer.stop()
 	}
 
 	if pc.heartbeatTimer != nil {
-		pc.heartbeatTimer.Stop()
+		pc.heartbeatTimer.stop()
 	}
 }
 
-// NewPRUDPConnection creates a new PRUDPConnection for a given socket
+// NewPRUDPConnection creates a new PRUDPConnection for a given socket.
+// The timers of the connection run on the timer wheels of socket.Server, so a connection
+// created without a server can't be connected, and is only useful for building packets
 func NewPRUDPConnection(socket *SocketConnection) *PRUDPConnection {
 	pc := &PRUDPConnection{
 		Socket:                              socket,
@@ -290,10 +479,19 @@ func NewPRUDPConnection(socket *SocketConnection) *PRUDPConnection {
 		OutgoingUnreliableSequenceIDCounter: NewCounter[uint16](1),
 		outgoingPingSequenceIDCounter:       NewCounter[uint16](0),
 		incomingFragmentBuffers:             NewMutexMap[uint8, []byte](),
+		pendingAcknowledgements:             make(map[uint8][]uint16),
+		unreliableReassembler:               NewUnreliablePacketReassembler(),
 		StationURLs:                         types.NewList[types.StationURL](),
 		mutex:                               &sync.Mutex{},
 		UnreliablePacketBaseKey:             make([]byte, md5.Size*2), // * Gets updated to the real value in SetSessionKey
 	}
 
+	pc.pacer = NewPacketPacer(pc)
+	pc.dataDispatcher = NewDataDispatcher(pc)
+
+	if socket.Server != nil {
+		pc.timerWheel = socket.Server.timerWheel()
+	}
+
 	return pc
 }
@@ -0,0 +1,118 @@
+package nex
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/PretendoNetwork/nex-go/v2/compression"
+	"github.com/lxzan/gws"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPRUDPConnectionFragmentSize(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		prudpVersion int
+		address      net.Addr
+		mtu          int
+		compression  compression.Algorithm
+		expected     int
+	}{
+		{"No MTU", 1, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, 0, compression.NewDummyCompression(), 1300},
+		{"PRUDPv0", 0, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, 1000, compression.NewDummyCompression(), 957},
+		{"PRUDPv1", 1, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, 1364, compression.NewDummyCompression(), 1303},
+		{"PRUDPv1 IPv6", 1, &net.UDPAddr{IP: net.IPv6loopback}, 1364, compression.NewDummyCompression(), 1283},
+		{"PRUDPv1 zlib", 1, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, 1364, compression.NewZlibCompression(), 1291},
+		{"PRUDPLite", 2, &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}, 1364, compression.NewDummyCompression(), 1304},
+		{"MTU too small", 1, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)}, 32, compression.NewDummyCompression(), 1300},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			server := NewPRUDPServer()
+			server.MTU = test.mtu
+
+			endpoint := NewPRUDPEndPoint(1)
+			endpoint.Server = server
+
+			var webSocketConnection *gws.Conn
+			if test.prudpVersion == 2 {
+				webSocketConnection = &gws.Conn{}
+			}
+
+			connection := NewPRUDPConnection(NewSocketConnection(server, test.address, webSocketConnection))
+			connection.endpoint = endpoint
+			connection.DefaultPRUDPVersion = test.prudpVersion
+			connection.StreamSettings = endpoint.DefaultStreamSettings.Copy()
+			connection.StreamSettings.CompressionAlgorithm = test.compression
+
+			assert.Equal(t, test.expected, connection.FragmentSize())
+		})
+	}
+}
+
+func TestPRUDPConnectionFragmentSizeCallback(t *testing.T) {
+	server := NewPRUDPServer()
+	endpoint := NewPRUDPEndPoint(1)
+	endpoint.Server = server
+	endpoint.CalcFragmentSizeCallback = func(connection *PRUDPConnection) int {
+		return 500
+	}
+
+	connection := NewPRUDPConnection(NewSocketConnection(server, &net.UDPAddr{}, nil))
+	connection.endpoint = endpoint
+
+	assert.Equal(t, 500, connection.FragmentSize())
+}
+
+func TestPRUDPConnectionHandshakeTimerRestarted(t *testing.T) {
+	_, endpoint, connection := newTestTimeoutConnection()
+	connection.StreamSettings.HandshakeTimeout = 1
+	connection.ConnectionState = StateConnecting
+
+	discriminator := fmt.Sprintf("%s-%d-%d", connection.Socket.Address.String(), connection.StreamType, connection.StreamID)
+	endpoint.Connections.Set(discriminator, connection)
+
+	connection.Lock()
+	connection.startHandshakeTimer()
+
+	// * The first timer fires and waits for the lock while a new SYN restarts the handshake
+	time.Sleep(20 * time.Millisecond)
+	connection.StreamSettings.HandshakeTimeout = 60000
+	connection.startHandshakeTimer()
+	connection.Unlock()
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, 1, endpoint.Connections.Size())
+
+	connection.Lock()
+	connection.endHandshake()
+	connection.Unlock()
+}
+
+func TestPRUDPConnectionPingKickAfterHeartbeat(t *testing.T) {
+	_, endpoint, connection := newTestTimeoutConnection()
+	connection.ConnectionState = StateConnected
+
+	discriminator := fmt.Sprintf("%s-%d-%d", connection.Socket.Address.String(), connection.StreamType, connection.StreamID)
+	endpoint.Connections.Set(discriminator, connection)
+
+	connection.Lock()
+	connection.StartHeartbeat()
+	connection.stopHeartbeatTimers()
+
+	// * The kick timer fired, but a packet arrived before the kick got the lock
+	connection.ResetHeartbeat()
+	connection.Unlock()
+
+	endpoint.kickSilentConnection(connection)
+	assert.Equal(t, 1, endpoint.Connections.Size())
+
+	// * Nothing arrived after the PING
+	connection.Lock()
+	connection.stopHeartbeatTimers()
+	connection.Unlock()
+
+	endpoint.kickSilentConnection(connection)
+	assert.Zero(t, endpoint.Connections.Size())
+}
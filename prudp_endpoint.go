@@ -1,10 +1,16 @@
 package nex
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"net"
 	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/PretendoNetwork/nex-go/v2/constants"
@@ -26,19 +32,51 @@ type PRUDPEndPoint struct {
 	packetHandlers                    map[uint16]func(pep *PRUDPEndPoint, packet PRUDPPacketInterface)
 	packetEventHandlers               map[string][]func(packet PacketInterface)
 	connectionEndedEventHandlers      []func(connection *PRUDPConnection)
+	connectionRejectedEventHandlers   []func(connection *PRUDPConnection, err *Error)
+	connectionReplacedEventHandlers   []func(oldConnection, newConnection *PRUDPConnection)
+	connectionMigratedEventHandlers   []func(connection *PRUDPConnection, oldAddress net.Addr)
 	errorEventHandlers                []func(err *Error)
 	ConnectionIDCounter               *Counter[uint32]
 	ServerAccount                     *Account
 	AccountDetailsByPID               func(pid types.PID) (*Account, *Error)
 	AccountDetailsByUsername          func(username string) (*Account, *Error)
 	IsSecureEndPoint                  bool
+	LenientSessionValidation          bool                 // * Accept packets with the wrong session ID. Only meant for clients known to send them
+	MaxHalfOpenConnections            int                  // * Max number of connections to this endpoint which may be in the middle of a handshake. 0 disables the limit
+	MaxConnections                    int                  // * Max number of connected clients. 0 disables the limit
+	MaxConnectionsPerPID              int                  // * Max number of connections a single user may have. Only checked on secure endpoints, where the PID is known. 0 disables the limit
+	DuplicateLoginPolicy              DuplicateLoginPolicy // * What to do when a user connects while already connected. Only used on secure endpoints, where the PID is known
+	AllowConnectionMigration          bool                 // * Move connections to a new address when their client sends a signed packet from it, such as after a NAT rebinding
 	CalcRetransmissionTimeoutCallback CalcRetransmissionTimeoutCallback
+	CalcFragmentSizeCallback          CalcFragmentSizeCallback
+	invalidChecksums                  atomic.Uint64
+	invalidSignatures                 atomic.Uint64
+	invalidSessions                   atomic.Uint64
+	rejectedConnections               atomic.Uint64
+	countedConnections                map[*PRUDPConnection]types.PID // * Connections counted towards MaxConnections and MaxConnectionsPerPID
+	connectionsByPID                  map[types.PID]int
+	connectionLimitsMutex             *sync.Mutex
+	connectionsBySession              map[connectionSessionKey][]*PRUDPConnection // * Connected connections, used to find the one a packet from an unknown address belongs to
+	connectionsBySessionMutex         *sync.Mutex
+	disconnectAcknowledged            chan struct{} // * Wakes up disconnectAll when a client acknowledges its DISCONNECT
+}
+
+// connectionSessionKey groups connections which a migrating packet could belong to, see migrateConnection
+type connectionSessionKey struct {
+	streamType constants.StreamType
+	streamID   uint8
+	version    int
+	sessionID  uint8
 }
 
 // CalcRetransmissionTimeoutCallback is an optional callback which can be used to override the RTO calculation
 // for packets sent by this `PRUDPEndpoint`
 type CalcRetransmissionTimeoutCallback func(rtt float64, sendCount uint32) time.Duration
 
+// CalcFragmentSizeCallback is an optional callback which can be used to override the max DATA payload size
+// for connections to this `PRUDPEndpoint`
+type CalcFragmentSizeCallback func(connection *PRUDPConnection) int
+
 // RegisterServiceProtocol registers a NEX service with the endpoint
 func (pep *PRUDPEndPoint) RegisterServiceProtocol(protocol ServiceProtocol) {
 	protocol.SetEndpoint(pep)
@@ -76,6 +114,25 @@ func (pep *PRUDPEndPoint) OnConnectionEnded(handler func(connection *PRUDPConnec
 	pep.connectionEndedEventHandlers = append(pep.connectionEndedEventHandlers, handler)
 }
 
+// OnConnectionRejected adds an event handler which is fired when a connection is rejected during the handshake,
+// because MaxConnections or MaxConnectionsPerPID has been reached or by the DuplicateLoginPolicy.
+// The client is not sent an ACK for its CONNECT
+func (pep *PRUDPEndPoint) OnConnectionRejected(handler func(connection *PRUDPConnection, err *Error)) {
+	pep.connectionRejectedEventHandlers = append(pep.connectionRejectedEventHandlers, handler)
+}
+
+// OnConnectionReplaced adds an event handler which is fired when a connection is disconnected because its user
+// connected again, when using DuplicateLoginKickOld. Fired after OnConnectionEnded has fired for the old connection
+func (pep *PRUDPEndPoint) OnConnectionReplaced(handler func(oldConnection, newConnection *PRUDPConnection)) {
+	pep.connectionReplacedEventHandlers = append(pep.connectionReplacedEventHandlers, handler)
+}
+
+// OnConnectionMigrated adds an event handler which is fired when a connection is moved to a new address,
+// when using AllowConnectionMigration. The connections Socket has already been updated
+func (pep *PRUDPEndPoint) OnConnectionMigrated(handler func(connection *PRUDPConnection, oldAddress net.Addr)) {
+	pep.connectionMigratedEventHandlers = append(pep.connectionMigratedEventHandlers, handler)
+}
+
 func (pep *PRUDPEndPoint) on(name string, handler func(packet PacketInterface)) {
 	if _, ok := pep.packetEventHandlers[name]; !ok {
 		pep.packetEventHandlers[name] = make([]func(packet PacketInterface), 0)
@@ -99,6 +156,24 @@ func (pep *PRUDPEndPoint) emitConnectionEnded(connection *PRUDPConnection) {
 	}
 }
 
+func (pep *PRUDPEndPoint) emitConnectionRejected(connection *PRUDPConnection, err *Error) {
+	for _, handler := range pep.connectionRejectedEventHandlers {
+		handler(connection, err)
+	}
+}
+
+func (pep *PRUDPEndPoint) emitConnectionReplaced(oldConnection, newConnection *PRUDPConnection) {
+	for _, handler := range pep.connectionReplacedEventHandlers {
+		handler(oldConnection, newConnection)
+	}
+}
+
+func (pep *PRUDPEndPoint) emitConnectionMigrated(connection *PRUDPConnection, oldAddress net.Addr) {
+	for _, handler := range pep.connectionMigratedEventHandlers {
+		handler(connection, oldAddress)
+	}
+}
+
 // EmitError calls all the endpoints error event handlers with the provided error
 func (pep *PRUDPEndPoint) EmitError(err *Error) {
 	for _, handler := range pep.errorEventHandlers {
@@ -116,6 +191,8 @@ func (pep *PRUDPEndPoint) CleanupConnection(connection *PRUDPConnection) {
 		found = true
 	})
 
+	pep.removeSessionConnection(connection)
+
 	// * Probably this connection is on a different PRUDPEndPoint
 	if !found {
 		logger.Warningf("Tried to delete connection %v (ID %v) but it doesn't exist!", discriminator, connection.ID)
@@ -126,28 +203,66 @@ func (pep *PRUDPEndPoint) CleanupConnection(connection *PRUDPConnection) {
 	connection.cleanup()
 }
 
+// kickSilentConnection removes a connection which did not answer the PING sent when its heartbeat ran out.
+// The heartbeat is checked again under the lock, as a packet may have arrived after the timer fired
+func (pep *PRUDPEndPoint) kickSilentConnection(connection *PRUDPConnection) {
+	connection.Lock()
+	defer connection.Unlock()
+
+	if connection.ConnectionState != StateConnected || connection.heartbeatTimer.scheduled() || connection.pingKickTimer.scheduled() {
+		return
+	}
+
+	pep.CleanupConnection(connection)
+}
+
 func (pep *PRUDPEndPoint) processPacket(packet PRUDPPacketInterface, socket *SocketConnection) {
-	streamType := packet.SourceVirtualPortStreamType()
-	streamID := packet.SourceVirtualPortStreamID()
-	discriminator := fmt.Sprintf("%s-%d-%d", socket.Address.String(), streamType, streamID)
-	connection := pep.Connections.GetOrSetDefault(discriminator, func() *PRUDPConnection {
-		connection := NewPRUDPConnection(socket)
-		connection.endpoint = pep
-		connection.ID = pep.ConnectionIDCounter.Next()
-		connection.DefaultPRUDPVersion = packet.Version()
-		connection.StreamType = streamType
-		connection.StreamID = streamID
-		connection.StreamSettings = pep.DefaultStreamSettings.Copy()
-		return connection
-	})
+	if packet, ok := packet.(*PRUDPPacketV0); ok && !packet.verifyChecksum() {
+		pep.invalidChecksums.Add(1)
+		pep.EmitError(NewError(ResultCodes.Transport.IncorrectRemoteAuthentication, fmt.Sprintf("Invalid PRUDPv0 checksum on packet from %s", socket.Address.String())))
+		return
+	}
+
+	discriminator := fmt.Sprintf("%s-%d-%d", socket.Address.String(), packet.SourceVirtualPortStreamType(), packet.SourceVirtualPortStreamID())
+	connection, stored := pep.Connections.Get(discriminator)
+	if !stored && pep.AllowConnectionMigration {
+		connection, stored = pep.migrateConnection(packet, socket, discriminator)
+	}
+
+	if !stored {
+		connection, stored = pep.acceptConnection(packet, socket, discriminator)
+		if connection == nil {
+			return
+		}
+	}
 
 	connection.Lock()
 	defer connection.Unlock()
 
 	packet.SetSender(connection)
 
+	// * Connections which were already connected start
+	// * a new handshake, and count as half-open again
+	if packet.Type() == constants.SynPacket && stored && !pep.beginHandshake(connection) {
+		return
+	}
+
+	if !pep.validateSession(packet) {
+		return
+	}
+
+	if !pep.verifySignature(packet) {
+		pep.invalidSignatures.Add(1)
+		pep.EmitError(NewError(ResultCodes.Transport.IncorrectRemoteAuthentication, fmt.Sprintf("Invalid signature on packet from %s", socket.Address.String())))
+		return
+	}
+
 	if packet.HasFlag(constants.PacketFlagAck) || packet.HasFlag(constants.PacketFlagMultiAck) {
 		pep.handleAcknowledgment(packet)
+
+		// * Acknowledgements are never kept after being handled,
+		// * and are most of the traffic of a busy server
+		packet.release()
 		return
 	}
 
@@ -158,6 +273,471 @@ func (pep *PRUDPEndPoint) processPacket(packet PRUDPPacketInterface, socket *Soc
 	}
 }
 
+// acceptConnection creates the connection for a packet from an unknown client. Only SYN packets may create
+// connections, and only while the half-open connection limits have not been reached. When SYN cookies are used
+// SYNs are answered here without creating anything, and the connection is only created once the client sends a
+// CONNECT using a valid cookie. Returns nil if the packet should be dropped, and whether the returned connection
+// is stored in the endpoint
+func (pep *PRUDPEndPoint) acceptConnection(packet PRUDPPacketInterface, socket *SocketConnection, discriminator string) (*PRUDPConnection, bool) {
+	var cookie []byte
+
+	switch packet.Type() {
+	case constants.SynPacket:
+		if pep.Server.UseSynCookies {
+			pep.handleCookieSyn(packet, socket)
+			return nil, false
+		}
+	case constants.ConnectPacket:
+		if !pep.Server.UseSynCookies {
+			return nil, false
+		}
+
+		if cookie = pep.checkSynCookie(packet, socket.Address); cookie == nil {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	// * Not logged, since this happens for every packet of a flood
+	if !pep.Server.halfOpenConnections.add(pep, socket.Address) {
+		return nil, false
+	}
+
+	connection := pep.newConnection(packet, socket)
+	connection.halfOpen = true
+
+	if cookie != nil {
+		connection.Signature = cookie
+		connection.ConnectionState = StateConnecting
+		connection.startHandshakeTimer()
+	}
+
+	stored := pep.Connections.GetOrSetDefault(discriminator, func() *PRUDPConnection {
+		connection.ID = pep.ConnectionIDCounter.Next()
+		return connection
+	})
+
+	// * Another packet from the same client created the connection first
+	if stored != connection {
+		connection.endHandshake()
+	}
+
+	return stored, true
+}
+
+// migrateConnection looks for the connection a packet from an unknown address belongs to, for when the NAT
+// mapping of a client changes during a session. Only reliable DATA packets which the connection has not received
+// yet are accepted, so packets captured from the old address can't be replayed to take over the session. The packet
+// must use the session ID of the connection, and be signed for it, regardless of whether signatures are normally
+// verified. If found the connection is moved to the new address. PRUDPLite connections can't be migrated, since
+// they have no signatures
+func (pep *PRUDPEndPoint) migrateConnection(packet PRUDPPacketInterface, socket *SocketConnection, discriminator string) (*PRUDPConnection, bool) {
+	if packet.Version() == 2 || packet.Type() != constants.DataPacket || !packet.HasFlag(constants.PacketFlagReliable) {
+		return nil, false
+	}
+
+	key := connectionSessionKey{
+		streamType: packet.SourceVirtualPortStreamType(),
+		streamID:   packet.SourceVirtualPortStreamID(),
+		version:    packet.Version(),
+		sessionID:  packet.SessionID(),
+	}
+
+	pep.connectionsBySessionMutex.Lock()
+	candidates := slices.Clone(pep.connectionsBySession[key])
+	pep.connectionsBySessionMutex.Unlock()
+
+	for _, connection := range candidates {
+		connection.Lock()
+
+		// * Check the sequence ID first, it's much cheaper than the signature
+		if connection.ConnectionState != StateConnected || !isFreshPacket(connection, packet) || !signatureMatches(packet, connection) {
+			connection.Unlock()
+			continue
+		}
+
+		oldAddress := connection.Socket.Address
+		oldDiscriminator := fmt.Sprintf("%s-%d-%d", oldAddress.String(), connection.StreamType, connection.StreamID)
+
+		pep.Connections.Delete(oldDiscriminator)
+		connection.Socket = socket
+		pep.Connections.Set(discriminator, connection)
+
+		connection.Unlock()
+
+		pep.emitConnectionMigrated(connection, oldAddress)
+
+		return connection, true
+	}
+
+	return nil, false
+}
+
+// isFreshPacket returns whether a reliable packet has not been received by the connection yet.
+// Must be called with the connection lock held
+func isFreshPacket(connection *PRUDPConnection, packet PRUDPPacketInterface) bool {
+	packetDispatchQueue, ok := connection.packetDispatchQueues.Get(packet.SubstreamID())
+	if !ok {
+		return false
+	}
+
+	return packetDispatchQueue.isFresh(packet)
+}
+
+// addSessionConnection makes a connected connection available to migrateConnection
+func (pep *PRUDPEndPoint) addSessionConnection(connection *PRUDPConnection) {
+	key := connectionSessionKey{
+		streamType: connection.StreamType,
+		streamID:   connection.StreamID,
+		version:    connection.DefaultPRUDPVersion,
+		sessionID:  connection.SessionID,
+	}
+
+	pep.connectionsBySessionMutex.Lock()
+	defer pep.connectionsBySessionMutex.Unlock()
+
+	// * The CONNECT may be handled more than once if the client resends it
+	if !slices.Contains(pep.connectionsBySession[key], connection) {
+		pep.connectionsBySession[key] = append(pep.connectionsBySession[key], connection)
+	}
+}
+
+// removeSessionConnection undoes addSessionConnection
+func (pep *PRUDPEndPoint) removeSessionConnection(connection *PRUDPConnection) {
+	key := connectionSessionKey{
+		streamType: connection.StreamType,
+		streamID:   connection.StreamID,
+		version:    connection.DefaultPRUDPVersion,
+		sessionID:  connection.SessionID,
+	}
+
+	pep.connectionsBySessionMutex.Lock()
+	defer pep.connectionsBySessionMutex.Unlock()
+
+	connections := slices.DeleteFunc(pep.connectionsBySession[key], func(pc *PRUDPConnection) bool {
+		return pc == connection
+	})
+
+	if len(connections) == 0 {
+		delete(pep.connectionsBySession, key)
+	} else {
+		pep.connectionsBySession[key] = connections
+	}
+}
+
+// newConnection creates a connection for the client which sent the packet, without storing it
+func (pep *PRUDPEndPoint) newConnection(packet PRUDPPacketInterface, socket *SocketConnection) *PRUDPConnection {
+	connection := NewPRUDPConnection(socket)
+	connection.endpoint = pep
+	connection.DefaultPRUDPVersion = packet.Version()
+	connection.StreamType = packet.SourceVirtualPortStreamType()
+	connection.StreamID = packet.SourceVirtualPortStreamID()
+	connection.StreamSettings = pep.DefaultStreamSettings.Copy()
+
+	return connection
+}
+
+// beginHandshake counts a stored connection as half-open and starts its handshake timer.
+// Returns false if the half-open connection limits have been reached
+func (pep *PRUDPEndPoint) beginHandshake(connection *PRUDPConnection) bool {
+	if !connection.halfOpen {
+		if !pep.Server.halfOpenConnections.add(pep, connection.Socket.Address) {
+			return false
+		}
+
+		connection.halfOpen = true
+	}
+
+	connection.startHandshakeTimer()
+
+	return true
+}
+
+// synCookie returns the connection signature sent in the SYN ACK when SYN cookies are used. It is derived from
+// PRUDPv1ConnectionSignatureKey, the clients address and the current time window, so the CONNECT packet can be
+// checked without having stored anything for the SYN. Cookies can't be checked if PRUDPv1 CONNECT packets are
+// not signed using them, see PRUDPV1Settings.LegacyConnectionSignature
+func (pep *PRUDPEndPoint) synCookie(packet PRUDPPacketInterface, address net.Addr, window int64) []byte {
+	data := binary.BigEndian.AppendUint64([]byte(address.String()), uint64(window))
+	data = append(data, uint8(packet.SourceVirtualPortStreamType()), packet.SourceVirtualPortStreamID(), pep.StreamID)
+
+	mac := hmac.New(md5.New, pep.Server.PRUDPv1ConnectionSignatureKey)
+	mac.Write(data)
+
+	cookie := mac.Sum(nil)
+
+	// * PRUDPv0 connection signatures are only 4 bytes
+	if packet.Version() == 0 {
+		return cookie[:4]
+	}
+
+	return cookie
+}
+
+// synCookieWindow returns the current time window for SYN cookies. Each window lasts for StreamSettings.HandshakeTimeout
+func (pep *PRUDPEndPoint) synCookieWindow() int64 {
+	if pep.DefaultStreamSettings.HandshakeTimeout == 0 {
+		return 0
+	}
+
+	return time.Now().UnixMilli() / int64(pep.DefaultStreamSettings.HandshakeTimeout)
+}
+
+// checkSynCookie returns the SYN cookie a CONNECT packet was signed with. Cookies from the current
+// and previous time windows are accepted. Returns nil if the packet was not signed with a valid cookie
+func (pep *PRUDPEndPoint) checkSynCookie(packet PRUDPPacketInterface, address net.Addr) []byte {
+	window := pep.synCookieWindow()
+
+	for _, window := range []int64{window, window - 1} {
+		cookie := pep.synCookie(packet, address, window)
+
+		if hmac.Equal(packet.Signature(), packet.CalculateSignature([]byte{}, cookie)) {
+			return cookie
+		}
+	}
+
+	return nil
+}
+
+// applyDuplicateLoginPolicy checks for other connections from the user of a connection completing its handshake,
+// and applies the DuplicateLoginPolicy to them. Returns an error if the new connection should be rejected
+func (pep *PRUDPEndPoint) applyDuplicateLoginPolicy(connection *PRUDPConnection) *Error {
+	if pep.DuplicateLoginPolicy == DuplicateLoginAllow {
+		return nil
+	}
+
+	oldConnections := make([]*PRUDPConnection, 0)
+
+	// * Connections are counted along with their PID once they connect, so
+	// * the old connections can be found without locking any of them
+	pep.connectionLimitsMutex.Lock()
+
+	for pc, pid := range pep.countedConnections {
+		if pc != connection && pid == connection.pid {
+			oldConnections = append(oldConnections, pc)
+		}
+	}
+
+	// * Kicked connections stop counting straight away,
+	// * so they don't count against the limits of the new one
+	if pep.DuplicateLoginPolicy == DuplicateLoginKickOld {
+		for _, oldConnection := range oldConnections {
+			pep.removeCountedConnection(oldConnection)
+		}
+	}
+
+	pep.connectionLimitsMutex.Unlock()
+
+	if len(oldConnections) == 0 {
+		return nil
+	}
+
+	if pep.DuplicateLoginPolicy == DuplicateLoginReject {
+		return NewError(ResultCodes.RendezVous.ConcurrentLoginDenied, fmt.Sprintf("PID %d is already connected", connection.pid))
+	}
+
+	// * The lock of the new connection is held here. Locking an old one as well
+	// * could deadlock with that connection replacing this one at the same time,
+	// * so they are kicked on their own goroutines
+	for _, oldConnection := range oldConnections {
+		go pep.kickConnection(oldConnection, connection)
+	}
+
+	return nil
+}
+
+// kickConnection disconnects a connection which was replaced by a new login from the same user
+func (pep *PRUDPEndPoint) kickConnection(oldConnection, newConnection *PRUDPConnection) {
+	oldConnection.Lock()
+
+	// * The old connection may have ended on its own in the meantime
+	connected := oldConnection.ConnectionState == StateConnected
+
+	if connected {
+		pep.sendDisconnect(oldConnection)
+		pep.CleanupConnection(oldConnection)
+	}
+
+	oldConnection.Unlock()
+
+	if connected {
+		pep.emitConnectionReplaced(oldConnection, newConnection)
+	}
+}
+
+// countConnection counts a connection which is completing its handshake towards MaxConnections and
+// MaxConnectionsPerPID. Returns an error if either limit has been reached
+func (pep *PRUDPEndPoint) countConnection(connection *PRUDPConnection) *Error {
+	pep.connectionLimitsMutex.Lock()
+	defer pep.connectionLimitsMutex.Unlock()
+
+	// * The client sent its CONNECT again, since the ACK was lost
+	if _, ok := pep.countedConnections[connection]; ok {
+		return nil
+	}
+
+	if pep.MaxConnections != 0 && len(pep.countedConnections) >= pep.MaxConnections {
+		return NewError(ResultCodes.RendezVous.MaxConnectionsReached, fmt.Sprintf("PRUDPEndPoint %d has reached its limit of %d connections", pep.StreamID, pep.MaxConnections))
+	}
+
+	pid := connection.PID()
+
+	if pep.IsSecureEndPoint && pep.MaxConnectionsPerPID != 0 && pep.connectionsByPID[pid] >= pep.MaxConnectionsPerPID {
+		return NewError(ResultCodes.RendezVous.MaxConnectionsReached, fmt.Sprintf("PID %d has reached its limit of %d connections", pid, pep.MaxConnectionsPerPID))
+	}
+
+	pep.countedConnections[connection] = pid
+	pep.connectionsByPID[pid]++
+
+	return nil
+}
+
+// uncountConnection stops counting a connection towards MaxConnections and MaxConnectionsPerPID
+func (pep *PRUDPEndPoint) uncountConnection(connection *PRUDPConnection) {
+	pep.connectionLimitsMutex.Lock()
+	defer pep.connectionLimitsMutex.Unlock()
+
+	pep.removeCountedConnection(connection)
+}
+
+// removeCountedConnection stops counting a connection. Must be called with connectionLimitsMutex held
+func (pep *PRUDPEndPoint) removeCountedConnection(connection *PRUDPConnection) {
+	pid, ok := pep.countedConnections[connection]
+	if !ok {
+		return
+	}
+
+	delete(pep.countedConnections, connection)
+
+	if pep.connectionsByPID[pid]--; pep.connectionsByPID[pid] <= 0 {
+		delete(pep.connectionsByPID, pid)
+	}
+}
+
+// rejectConnection removes a connection which could not complete its handshake. Unlike CleanupConnection,
+// OnConnectionEnded is not fired, since the connection was never connected
+func (pep *PRUDPEndPoint) rejectConnection(connection *PRUDPConnection, err *Error) {
+	discriminator := fmt.Sprintf("%s-%d-%d", connection.Socket.Address.String(), connection.StreamType, connection.StreamID)
+
+	pep.Connections.Delete(discriminator)
+
+	connection.Reset()
+	connection.stopHeartbeatTimers()
+	connection.endHandshake()
+
+	pep.rejectedConnections.Add(1)
+	pep.emitConnectionRejected(connection, err)
+}
+
+// RejectedConnections returns the number of connections rejected because MaxConnections or MaxConnectionsPerPID was reached
+func (pep *PRUDPEndPoint) RejectedConnections() uint64 {
+	return pep.rejectedConnections.Load()
+}
+
+// HalfOpenConnections returns the number of connections to this endpoint which are in the middle of a handshake
+func (pep *PRUDPEndPoint) HalfOpenConnections() int {
+	return pep.Server.halfOpenConnections.count(pep)
+}
+
+// validateSession checks that a packet belongs to the current session of its connection.
+// Only SYN and CONNECT packets may be sent before the handshake is complete, every other
+// packet must use the session ID negotiated during it
+func (pep *PRUDPEndPoint) validateSession(packet PRUDPPacketInterface) bool {
+	if packet.Type() == constants.SynPacket || packet.Type() == constants.ConnectPacket {
+		return true
+	}
+
+	connection := packet.Sender().(*PRUDPConnection)
+
+	// * Usually retransmissions from an old session, so these
+	// * are dropped without reporting them. Connections being
+	// * disconnected are only waiting for the DISCONNECT ACK
+	if connection.ConnectionState == StateDisconnecting {
+		if packet.Type() != constants.DisconnectPacket {
+			return false
+		}
+	} else if connection.ConnectionState != StateConnected {
+		return false
+	}
+
+	// * PRUDPLite has no connection signatures
+	if packet.Version() != 2 && (len(connection.Signature) == 0 || len(connection.ServerConnectionSignature) == 0) {
+		return false
+	}
+
+	if packet.SessionID() == connection.SessionID {
+		return true
+	}
+
+	if pep.LenientSessionValidation {
+		logger.Warningf("Accepting packet from %s with session ID %d, expected %d", connection.Address().String(), packet.SessionID(), connection.SessionID)
+		return true
+	}
+
+	pep.invalidSessions.Add(1)
+	pep.EmitError(NewError(ResultCodes.Transport.IncorrectRemoteAuthentication, fmt.Sprintf("Invalid session ID %d on packet from %s", packet.SessionID(), connection.Address().String())))
+
+	return false
+}
+
+// verifySignature checks the signature of an inbound packet against the one calculated for its connection.
+// Packets must be verified before their payload is decrypted, since signatures are calculated over the sent payload
+func (pep *PRUDPEndPoint) verifySignature(packet PRUDPPacketInterface) bool {
+	switch packet.Version() {
+	case 0:
+		if !pep.Server.PRUDPV0Settings.VerifySignatures {
+			return true
+		}
+	case 1:
+		if !pep.Server.PRUDPV1Settings.VerifySignatures {
+			return true
+		}
+	default:
+		// * PRUDPLite has no signatures. Packets can only
+		// * be sent by the WebSocket connection itself
+		return true
+	}
+
+	// * SYN packets are sent before there is anything
+	// * to sign them with, so their signature is constant
+	if packet.Type() == constants.SynPacket {
+		return true
+	}
+
+	return signatureMatches(packet, packet.Sender().(*PRUDPConnection))
+}
+
+// signatureMatches checks if a packet was signed for the given connection
+func signatureMatches(packet PRUDPPacketInterface, connection *PRUDPConnection) bool {
+	// * Packets are signed using the connection signature of the receiver,
+	// * which is the one we sent in the SYN ACK. CONNECT packets are sent
+	// * before the session key is known
+	sessionKey := connection.SessionKey
+	if packet.Type() == constants.ConnectPacket {
+		sessionKey = []byte{}
+	}
+
+	expected := packet.CalculateSignature(sessionKey, connection.Signature)
+
+	return hmac.Equal(packet.Signature(), expected)
+}
+
+// InvalidChecksums returns the number of inbound packets dropped because of an invalid checksum
+func (pep *PRUDPEndPoint) InvalidChecksums() uint64 {
+	return pep.invalidChecksums.Load()
+}
+
+// InvalidSignatures returns the number of inbound packets dropped because of an invalid signature
+func (pep *PRUDPEndPoint) InvalidSignatures() uint64 {
+	return pep.invalidSignatures.Load()
+}
+
+// InvalidSessions returns the number of inbound packets dropped because of an invalid session ID
+func (pep *PRUDPEndPoint) InvalidSessions() uint64 {
+	return pep.invalidSessions.Load()
+}
+
 func (pep *PRUDPEndPoint) handleAcknowledgment(packet PRUDPPacketInterface) {
 	connection := packet.Sender().(*PRUDPConnection)
 
@@ -172,6 +752,20 @@ func (pep *PRUDPEndPoint) handleAcknowledgment(packet PRUDPPacketInterface) {
 		return
 	}
 
+	// * Sent by clients which received the DISCONNECT sent by disconnectAll
+	if packet.Type() == constants.DisconnectPacket {
+		if connection.ConnectionState == StateDisconnecting {
+			pep.CleanupConnection(connection)
+
+			select {
+			case pep.disconnectAcknowledged <- struct{}{}:
+			default:
+			}
+		}
+
+		return
+	}
+
 	if packet.Type() == constants.PingPacket {
 		if packet.SequenceID() == connection.outgoingPingSequenceIDCounter.Value {
 			connection.rtt.Adjust(time.Since(connection.lastSentPingTime))
@@ -179,6 +773,7 @@ func (pep *PRUDPEndPoint) handleAcknowledgment(packet PRUDPPacketInterface) {
 	} else {
 		slidingWindow := connection.SlidingWindow(packet.SubstreamID())
 		slidingWindow.TimeoutManager.AcknowledgePacket(packet.SequenceID())
+		slidingWindow.TimeoutManager.detectLoss(packet.SequenceID())
 	}
 }
 
@@ -214,26 +809,67 @@ func (pep *PRUDPEndPoint) handleMultiAcknowledgment(packet PRUDPPacketInterface)
 		}
 	}
 
-	// * MutexMap.Each locks the mutex, can't remove while reading.
-	// * Have to just loop again
-	slidingWindow.TimeoutManager.packets.Each(func(sequenceID uint16, pending PRUDPPacketInterface) bool {
-		if sequenceID <= baseSequenceID && !slices.Contains(sequenceIDs, sequenceID) {
-			sequenceIDs = append(sequenceIDs, sequenceID)
-		}
+	slidingWindow.TimeoutManager.AcknowledgePacketsUpTo(baseSequenceID)
 
-		return false
-	})
+	highestSequenceID := baseSequenceID
 
-	// * Actually remove the packets from the pool
 	for _, sequenceID := range sequenceIDs {
 		slidingWindow.TimeoutManager.AcknowledgePacket(sequenceID)
+
+		if sequenceIDLess(highestSequenceID, sequenceID) {
+			highestSequenceID = sequenceID
+		}
 	}
+
+	// * Anything still pending below the highest acknowledged
+	// * sequence ID is a gap, which may need to be resent early
+	slidingWindow.TimeoutManager.detectLoss(highestSequenceID)
 }
 
 func (pep *PRUDPEndPoint) handleSyn(packet PRUDPPacketInterface) {
 	connection := packet.Sender().(*PRUDPConnection)
 	connection.ResetHeartbeat()
 
+	var connectionSignature []byte
+	var err error
+
+	if pep.Server.UseSynCookies {
+		connectionSignature = pep.synCookie(packet, connection.Socket.Address, pep.synCookieWindow())
+	} else {
+		connectionSignature, err = packet.CalculateConnectionSignature(connection.Socket.Address)
+		if err != nil {
+			logger.Error(err.Error())
+		}
+	}
+
+	connection.Reset()
+	connection.Signature = connectionSignature
+
+	ack := pep.newSynAck(packet, connection, connectionSignature)
+
+	connection.ConnectionState = StateConnecting
+
+	pep.Emit("syn", ack)
+
+	pep.Server.SendRaw(connection.Socket, ack.Bytes())
+}
+
+// handleCookieSyn answers a SYN from a new client when SYN cookies are used. Nothing is created for the
+// client until it sends a CONNECT using a valid cookie, so the syn event is not emitted for these SYNs
+func (pep *PRUDPEndPoint) handleCookieSyn(packet PRUDPPacketInterface, socket *SocketConnection) {
+	// * Clients never acknowledge anything before connecting
+	if packet.HasFlag(constants.PacketFlagAck) || packet.HasFlag(constants.PacketFlagMultiAck) {
+		return
+	}
+
+	cookie := pep.synCookie(packet, socket.Address, pep.synCookieWindow())
+	ack := pep.newSynAck(packet, nil, cookie)
+
+	pep.Server.SendRaw(socket, ack.Bytes())
+}
+
+// newSynAck creates the SYN ACK for a SYN packet. The connection may be nil when SYN cookies are used
+func (pep *PRUDPEndPoint) newSynAck(packet PRUDPPacketInterface, connection *PRUDPConnection, connectionSignature []byte) PRUDPPacketInterface {
 	var ack PRUDPPacketInterface
 
 	if packet.Version() == 2 {
@@ -244,14 +880,6 @@ func (pep *PRUDPEndPoint) handleSyn(packet PRUDPPacketInterface) {
 		ack, _ = NewPRUDPPacketV0(pep.Server, connection, nil)
 	}
 
-	connectionSignature, err := packet.CalculateConnectionSignature(connection.Socket.Address)
-	if err != nil {
-		logger.Error(err.Error())
-	}
-
-	connection.Reset()
-	connection.Signature = connectionSignature
-
 	ack.SetType(constants.SynPacket)
 	ack.AddFlag(constants.PacketFlagAck)
 	ack.AddFlag(constants.PacketFlagHasSize)
@@ -270,11 +898,7 @@ func (pep *PRUDPEndPoint) handleSyn(packet PRUDPPacketInterface) {
 
 	ack.SetSignature(ack.CalculateSignature([]byte{}, []byte{}))
 
-	connection.ConnectionState = StateConnecting
-
-	pep.Emit("syn", ack)
-
-	pep.Server.SendRaw(connection.Socket, ack.Bytes())
+	return ack
 }
 
 func (pep *PRUDPEndPoint) handleConnect(packet PRUDPPacketInterface) {
@@ -326,10 +950,18 @@ func (pep *PRUDPEndPoint) handleConnect(packet PRUDPPacketInterface) {
 		ack.MinorVersion = packet.(*PRUDPPacketV1).MinorVersion
 		ack.SupportedFunctions = packet.(*PRUDPPacketV1).SupportedFunctions
 
+		connection.MinorVersion = ack.MinorVersion
+		connection.SupportedFunctions = ack.SupportedFunctions
+
 		connection.InitializeSlidingWindows(ack.MaximumSubstreamID)
 		connection.InitializePacketDispatchQueues(ack.MaximumSubstreamID)
 		connection.OutgoingUnreliableSequenceIDCounter = NewCounter[uint16](packet.(*PRUDPPacketV1).InitialUnreliableSequenceID)
 	} else {
+		if packet, ok := packet.(*PRUDPPacketLite); ok {
+			connection.MinorVersion = packet.minorVersion
+			connection.SupportedFunctions = packet.supportedFunctions
+		}
+
 		connection.InitializeSlidingWindows(0)
 		connection.InitializePacketDispatchQueues(0)
 	}
@@ -364,6 +996,11 @@ func (pep *PRUDPEndPoint) handleConnect(packet PRUDPPacketInterface) {
 		connection.SetPID(pid)
 		connection.SetSessionKey(sessionKey)
 
+		if err := pep.applyDuplicateLoginPolicy(connection); err != nil {
+			pep.rejectConnection(connection, err)
+			return
+		}
+
 		responseCheckValue := checkValue + 1
 		responseCheckValueBytes := make([]byte, 4)
 
@@ -377,6 +1014,11 @@ func (pep *PRUDPEndPoint) handleConnect(packet PRUDPPacketInterface) {
 		payload = stream.Bytes()
 	}
 
+	if err := pep.countConnection(connection); err != nil {
+		pep.rejectConnection(connection, err)
+		return
+	}
+
 	if len(payload) != 0 {
 		compressedPayload, err := connection.StreamSettings.CompressionAlgorithm.Compress(payload)
 		if err != nil {
@@ -401,7 +1043,9 @@ func (pep *PRUDPEndPoint) handleConnect(packet PRUDPPacketInterface) {
 	ack.SetSignature(ack.CalculateSignature([]byte{}, packet.GetConnectionSignature()))
 
 	connection.ConnectionState = StateConnected
+	connection.endHandshake()
 	connection.StartHeartbeat()
+	pep.addSessionConnection(connection)
 
 	pep.Emit("connect", ack)
 
@@ -425,8 +1069,8 @@ func (pep *PRUDPEndPoint) handleData(packet PRUDPPacketInterface) {
 }
 
 func (pep *PRUDPEndPoint) handleDisconnect(packet PRUDPPacketInterface) {
-	// TODO - Should we check the state here, or just let the connection disconnect at any time?
-
+	// * The session was already validated in processPacket,
+	// * so only the connected client can disconnect itself
 	if packet.HasFlag(constants.PacketFlagNeedsAck) {
 		pep.AcknowledgePacket(packet)
 	}
@@ -533,6 +1177,36 @@ func (pep *PRUDPEndPoint) ReadKerberosTicket(payload []byte) ([]byte, types.PID,
 }
 
 func (pep *PRUDPEndPoint) AcknowledgePacket(packet PRUDPPacketInterface) {
+	connection := packet.Sender().(*PRUDPConnection)
+
+	if pep.canAggregateAcknowledgement(packet) {
+		substreamID := packet.SubstreamID()
+		connection.pendingAcknowledgements[substreamID] = append(connection.pendingAcknowledgements[substreamID], packet.SequenceID())
+
+		if connection.acknowledgementTimer == nil {
+			var timer *wheelTimer
+
+			// * Run on its own goroutine, since it takes
+			// * the connection lock and the wheel must not block
+			timer = newWheelTimer(connection.timerWheel, func() {
+				go func() {
+					connection.Lock()
+					defer connection.Unlock()
+
+					// * The connection may have been reset while this waited for the lock
+					if connection.acknowledgementTimer == timer {
+						pep.sendAggregateAcknowledgements(connection)
+					}
+				}()
+			})
+
+			connection.acknowledgementTimer = timer
+			timer.reset(time.Duration(connection.StreamSettings.AggregateAckDelay) * time.Millisecond)
+		}
+
+		return
+	}
+
 	var ack PRUDPPacketInterface
 
 	if packet.Version() == 2 {
@@ -560,19 +1234,130 @@ func (pep *PRUDPEndPoint) AcknowledgePacket(packet PRUDPPacketInterface) {
 		pep.Server.sendPacket(ack)
 		pep.Server.sendPacket(ack)
 	}
+
+	// * sendPacket sends a copy, so the ACK itself can be reused
+	ack.release()
 }
 
-// HandleReliable handles reliable PRUDP DATA packets.
-func (pep *PRUDPEndPoint) HandleReliable(packet PRUDPPacketInterface) {
-	if packet.HasFlag(constants.PacketFlagNeedsAck) {
-		pep.AcknowledgePacket(packet)
+func (pep *PRUDPEndPoint) canAggregateAcknowledgement(packet PRUDPPacketInterface) bool {
+	connection := packet.Sender().(*PRUDPConnection)
+
+	if connection.StreamSettings.AggregateAckDelay == 0 || connection.ConnectionState != StateConnected {
+		return false
+	}
+
+	if packet.Type() != constants.DataPacket || !packet.HasFlag(constants.PacketFlagReliable) {
+		return false
+	}
+
+	return packet.SubstreamID() == 0 || connection.usesNewAggregateAckFormat()
+}
+
+// sendAggregateAcknowledgements sends all pending acknowledgements for the connection as aggregate ACK packets.
+// Must be called with the connection locked
+func (pep *PRUDPEndPoint) sendAggregateAcknowledgements(connection *PRUDPConnection) {
+	connection.acknowledgementTimer = nil
+
+	if connection.ConnectionState != StateConnected {
+		return
+	}
+
+	for substreamID, sequenceIDs := range connection.pendingAcknowledgements {
+		// * Every packet up to the last one dispatched has been
+		// * received, so only packets received out of order need
+		// * to be listed individually
+		baseSequenceID := connection.PacketDispatchQueue(substreamID).nextExpectedSequenceId.Value - 1
+		additionalIDs := make([]uint16, 0, len(sequenceIDs))
+
+		for _, sequenceID := range sequenceIDs {
+			if sequenceIDLess(baseSequenceID, sequenceID) && !slices.Contains(additionalIDs, sequenceID) {
+				additionalIDs = append(additionalIDs, sequenceID)
+			}
+		}
+
+		// * The new format can only list 255 additional IDs per packet
+		for {
+			count := len(additionalIDs)
+			if connection.usesNewAggregateAckFormat() {
+				count = min(count, 0xFF)
+			}
+
+			pep.sendAggregateAcknowledgement(connection, substreamID, baseSequenceID, additionalIDs[:count])
+
+			additionalIDs = additionalIDs[count:]
+			if len(additionalIDs) == 0 {
+				break
+			}
+		}
+	}
+
+	clear(connection.pendingAcknowledgements)
+}
+
+func (pep *PRUDPEndPoint) sendAggregateAcknowledgement(connection *PRUDPConnection, substreamID uint8, baseSequenceID uint16, additionalIDs []uint16) {
+	var ack PRUDPPacketInterface
+
+	if connection.DefaultPRUDPVersion == 2 {
+		ack, _ = NewPRUDPPacketLite(pep.Server, connection, nil)
+	} else if connection.DefaultPRUDPVersion == 1 {
+		ack, _ = NewPRUDPPacketV1(pep.Server, connection, nil)
+	} else {
+		ack, _ = NewPRUDPPacketV0(pep.Server, connection, nil)
+		ack.AddFlag(constants.PacketFlagHasSize)
+	}
+
+	ack.SetType(constants.DataPacket)
+	ack.AddFlag(constants.PacketFlagMultiAck)
+	ack.SetSourceVirtualPortStreamType(connection.StreamType)
+	ack.SetSourceVirtualPortStreamID(pep.StreamID)
+	ack.SetDestinationVirtualPortStreamType(connection.StreamType)
+	ack.SetDestinationVirtualPortStreamID(connection.StreamID)
+
+	stream := NewByteStreamOut(pep.Server.LibraryVersions, pep.ByteStreamSettings())
+
+	if connection.usesNewAggregateAckFormat() {
+		// * New aggregate acknowledgment packets set this to 1
+		// * and encode the real substream ID in in the payload
+		ack.SetSubstreamID(1)
+
+		stream.WriteUInt8(substreamID)
+		stream.WriteUInt8(uint8(len(additionalIDs)))
+		stream.WriteUInt16LE(baseSequenceID)
+	} else {
+		// * Old aggregate acknowledgment packets always use
+		// * substream 0 and send the base ID in the header
+		ack.SetSubstreamID(0)
+		ack.SetSequenceID(baseSequenceID)
 	}
 
+	for _, sequenceID := range additionalIDs {
+		stream.WriteUInt16LE(sequenceID)
+	}
+
+	ack.SetPayload(stream.Bytes())
+
+	pep.Server.sendPacket(ack)
+}
+
+// HandleReliable handles reliable PRUDP DATA packets.
+func (pep *PRUDPEndPoint) HandleReliable(packet PRUDPPacketInterface) {
 	connection := packet.Sender().(*PRUDPConnection)
 
 	substreamID := packet.SubstreamID()
 
 	packetDispatchQueue := connection.PacketDispatchQueue(substreamID)
+
+	// * Dropped packets are not acknowledged, so the
+	// * client sends them again once there is room
+	if err := packetDispatchQueue.checkLimits(packet); err != nil {
+		pep.EmitError(NewError(ResultCodes.Transport.PacketBufferFull, fmt.Sprintf("Dropped reliable packet from %s: %s", connection.Address().String(), err)))
+		return
+	}
+
+	if packet.HasFlag(constants.PacketFlagNeedsAck) {
+		pep.AcknowledgePacket(packet)
+	}
+
 	packetDispatchQueue.Queue(packet)
 
 	for nextPacket, ok := packetDispatchQueue.GetNextToDispatch(); ok; nextPacket, ok = packetDispatchQueue.GetNextToDispatch() {
@@ -592,6 +1377,15 @@ func (pep *PRUDPEndPoint) HandleReliable(packet PRUDPPacketInterface) {
 			}
 
 			incomingFragmentBuffer := connection.GetIncomingFragmentBuffer(substreamID)
+
+			if maxSize := connection.StreamSettings.MaxReassembledMessageSize; maxSize != 0 && uint64(len(incomingFragmentBuffer))+uint64(len(decompressedPayload)) > uint64(maxSize) {
+				pep.EmitError(NewError(ResultCodes.Transport.NoBuffer, fmt.Sprintf("Reassembled message from %s is larger than %d bytes, disconnecting", connection.Address().String(), maxSize)))
+				pep.sendDisconnect(connection)
+				pep.CleanupConnection(connection)
+
+				return
+			}
+
 			incomingFragmentBuffer = append(incomingFragmentBuffer, decompressedPayload...)
 			connection.SetIncomingFragmentBuffer(substreamID, incomingFragmentBuffer)
 
@@ -606,7 +1400,7 @@ func (pep *PRUDPEndPoint) HandleReliable(packet PRUDPPacketInterface) {
 				nextPacket.SetRMCMessage(message)
 				connection.ClearOutgoingBuffer(substreamID)
 
-				pep.Emit("data", nextPacket)
+				connection.dataDispatcher.Dispatch(nextPacket)
 			}
 		}
 
@@ -620,49 +1414,28 @@ func (pep *PRUDPEndPoint) HandleUnreliable(packet PRUDPPacketInterface) {
 		pep.AcknowledgePacket(packet)
 	}
 
-	// * Since unreliable DATA packets can in theory reach the
-	// * server in any order, and they lack a subsslidingWindowtream, it's
-	// * not actually possible to know what order they should
-	// * be processed in for each request. So assume all packets
-	// * MUST be fragment 0 (unreliable packets do not have frags)
-	// *
-	// * Example -
-	// *
-	// * Say there is 2 requests to the same protocol, methods 1
-	// * and 2. The starting unreliable sequence ID is 10. If both
-	// * method 1 and 2 are called at the same time, but method 1
-	// * has a fragmented payload, the packets could, in theory, reach
-	// * the server like so:
-	// *
-	// *	- Method1 - Sequence 10, Fragment 1
-	// *	- Method1 - Sequence 13, Fragment 3
-	// *	- Method2 - Sequence 12, Fragment 0
-	// *	- Method1 - Sequence 11, Fragment 2
-	// *	- Method1 - Sequence 14, Fragment 0
-	// *
-	// * If we reorder these to the proper order, like so:
-	// *
-	// *	- Method1 - Sequence 10, Fragment 1
-	// *	- Method1 - Sequence 11, Fragment 2
-	// *	- Method2 - Sequence 12, Fragment 0
-	// *	- Method1 - Sequence 13, Fragment 3
-	// *	- Method1 - Sequence 14, Fragment 0
-	// *
-	// * We still have a gap where Method2 was called. It's not
-	// * possible to know if the packet with sequence ID 12 belongs
-	// * to the Method1 calls or not. We don't even know which methods
-	// * the packets are for at this stage yet, since the RMC data
-	// * can't be checked until all the fragments are collected and
-	// * the payload decrypted. In this case, we would see fragment 0
-	// * and assume that's the end of fragments, losing the real last
-	// * fragments and resulting in a bad decryption
-	// TODO - Is this actually true? I'm just assuming, based on common sense, tbh. Kinnay also does not implement fragmented unreliable packets?
-	if packet.getFragmentID() != 0 {
-		logger.Warningf("Unexpected unreliable fragment ID. Expected 0, got %d", packet.getFragmentID())
-		return
+	connection := packet.Sender().(*PRUDPConnection)
+
+	var payload []byte
+
+	// * PRUDPLite does not encrypt payloads
+	if packet.Version() != 2 {
+		payload = packet.processUnreliableCrypto()
+	} else {
+		payload = packet.Payload()
 	}
 
-	payload := packet.processUnreliableCrypto()
+	// * Fragment ID 0 is used both by whole messages and by the final
+	// * fragment of a fragmented one. Only a final fragment follows a
+	// * stored fragment, anything else is handled on its own
+	if packet.getFragmentID() != 0 || connection.unreliableReassembler.continuesMessage(packet) {
+		var ok bool
+
+		packet, payload, ok = connection.unreliableReassembler.Add(packet, payload, connection.StreamSettings)
+		if !ok {
+			return
+		}
+	}
 
 	message := NewRMCMessage(pep)
 	err := message.FromBytes(payload)
@@ -673,7 +1446,7 @@ func (pep *PRUDPEndPoint) HandleUnreliable(packet PRUDPPacketInterface) {
 
 	packet.SetRMCMessage(message)
 
-	pep.Emit("data", packet)
+	connection.dataDispatcher.Dispatch(packet)
 }
 
 func (pep *PRUDPEndPoint) sendPing(connection *PRUDPConnection) {
@@ -699,6 +1472,122 @@ func (pep *PRUDPEndPoint) sendPing(connection *PRUDPConnection) {
 	pep.Server.sendPacket(ping)
 }
 
+func (pep *PRUDPEndPoint) sendDisconnect(connection *PRUDPConnection) {
+	var disconnect PRUDPPacketInterface
+
+	switch connection.DefaultPRUDPVersion {
+	case 0:
+		disconnect, _ = NewPRUDPPacketV0(pep.Server, connection, nil)
+	case 1:
+		disconnect, _ = NewPRUDPPacketV1(pep.Server, connection, nil)
+	case 2:
+		disconnect, _ = NewPRUDPPacketLite(pep.Server, connection, nil)
+	}
+
+	disconnect.SetType(constants.DisconnectPacket)
+	disconnect.AddFlag(constants.PacketFlagNeedsAck)
+	disconnect.SetSourceVirtualPortStreamType(connection.StreamType)
+	disconnect.SetSourceVirtualPortStreamID(pep.StreamID)
+	disconnect.SetDestinationVirtualPortStreamType(connection.StreamType)
+	disconnect.SetDestinationVirtualPortStreamID(connection.StreamID)
+	disconnect.SetSubstreamID(0)
+
+	pep.Server.sendPacket(disconnect)
+}
+
+const (
+	disconnectResendInterval = 250 * time.Millisecond // * How long disconnectAll waits for a DISCONNECT to be acknowledged before resending it
+	disconnectResends        = 4                      // * How many times disconnectAll resends a DISCONNECT
+)
+
+// disconnectAll sends a DISCONNECT packet to every connected client and cleans up all connections on the endpoint.
+// Connected clients are kept until they acknowledge the DISCONNECT, which is resent every disconnectResendInterval
+// up to disconnectResends times, so a lost DISCONNECT doesn't leave them waiting for the connection to time out.
+// Returns early if the context ends
+func (pep *PRUDPEndPoint) disconnectAll(ctx context.Context) {
+	connections := make([]*PRUDPConnection, 0, pep.Connections.Size())
+
+	// * We cannot modify a MutexMap while looping over it
+	pep.Connections.Each(func(_ string, connection *PRUDPConnection) bool {
+		connections = append(connections, connection)
+		return false
+	})
+
+	disconnecting := make([]*PRUDPConnection, 0, len(connections))
+
+	for _, connection := range connections {
+		connection.Lock()
+
+		if connection.ConnectionState == StateConnected {
+			// * Removed once the client acknowledges the DISCONNECT, see handleAcknowledgment
+			connection.ConnectionState = StateDisconnecting
+			connection.stopHeartbeatTimers()
+
+			pep.sendDisconnect(connection)
+			disconnecting = append(disconnecting, connection)
+		} else {
+			pep.CleanupConnection(connection)
+		}
+
+		connection.Unlock()
+	}
+
+	ticker := time.NewTicker(disconnectResendInterval)
+	defer ticker.Stop()
+
+	resends := 0
+
+wait:
+	for len(disconnecting) != 0 {
+		select {
+		case <-pep.disconnectAcknowledged:
+			disconnecting = pep.pendingDisconnects(disconnecting, false)
+		case <-ticker.C:
+			if resends == disconnectResends {
+				break wait
+			}
+
+			resends++
+			disconnecting = pep.pendingDisconnects(disconnecting, true)
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	// * Clients which never acknowledged it are removed anyway
+	for _, connection := range disconnecting {
+		connection.Lock()
+
+		if connection.ConnectionState == StateDisconnecting {
+			pep.CleanupConnection(connection)
+		}
+
+		connection.Unlock()
+	}
+}
+
+// pendingDisconnects returns the connections which have not acknowledged their DISCONNECT yet,
+// resending it to them if resend is set
+func (pep *PRUDPEndPoint) pendingDisconnects(connections []*PRUDPConnection, resend bool) []*PRUDPConnection {
+	remaining := connections[:0]
+
+	for _, connection := range connections {
+		connection.Lock()
+
+		if connection.ConnectionState == StateDisconnecting {
+			if resend {
+				pep.sendDisconnect(connection)
+			}
+
+			remaining = append(remaining, connection)
+		}
+
+		connection.Unlock()
+	}
+
+	return remaining
+}
+
 // FindConnectionByID returns the PRUDP client connected with the given connection ID
 func (pep *PRUDPEndPoint) FindConnectionByID(connectedID uint32) *PRUDPConnection {
 	var connection *PRUDPConnection
@@ -736,12 +1625,28 @@ func (pep *PRUDPEndPoint) ComputeRetransmitTimeout(packet PRUDPPacketInterface)
 	connection := packet.Sender().(*PRUDPConnection)
 	rtt := connection.rtt
 
+	var rto time.Duration
+
 	if callback := pep.CalcRetransmissionTimeoutCallback; callback != nil {
 		rttAverage := rtt.GetRTTSmoothedAvg()
 		rttDeviation := rtt.GetRTTSmoothedDev()
-		return callback(rttAverage+rttDeviation*4.0, packet.SendCount())
+		rto = callback(rttAverage+rttDeviation*4.0, packet.SendCount())
+	} else {
+		rto = pep.computeDefaultRetransmitTimeout(packet)
 	}
 
+	if maxRTO := connection.StreamSettings.MaxRetransmitTimeout; maxRTO != 0 {
+		rto = min(rto, time.Duration(maxRTO)*time.Millisecond)
+	}
+
+	return rto
+}
+
+// computeDefaultRetransmitTimeout computes the RTO of a packet when no CalcRetransmissionTimeoutCallback is set
+func (pep *PRUDPEndPoint) computeDefaultRetransmitTimeout(packet PRUDPPacketInterface) time.Duration {
+	connection := packet.Sender().(*PRUDPConnection)
+	rtt := connection.rtt
+
 	var retransmitTimeBase int64
 	if packet.Type() == constants.SynPacket {
 		retransmitTimeBase = int64(pep.DefaultStreamSettings.SynInitialRTT)
@@ -752,7 +1657,12 @@ func (pep *PRUDPEndPoint) ComputeRetransmitTimeout(packet PRUDPPacketInterface)
 		}
 	}
 
-	retransmitTimeBaseMultiplier := packet.SendCount()
+	retransmitTimeBaseMultiplier := int64(packet.SendCount())
+	if connection.StreamSettings.ExponentialBackoff {
+		// * Double the RTO with every resend rather than growing it linearly. The
+		// * shift is limited so the RTO can't overflow before MaxRetransmitTimeout
+		retransmitTimeBaseMultiplier = int64(1) << min(max(packet.SendCount(), 1)-1, 16)
+	}
 
 	var retransmitMultiplier float64
 	if packet.SendCount() < pep.DefaultStreamSettings.ExtraRetransmitTimeoutTrigger {
@@ -761,7 +1671,7 @@ func (pep *PRUDPEndPoint) ComputeRetransmitTimeout(packet PRUDPPacketInterface)
 		retransmitMultiplier = float64(pep.DefaultStreamSettings.ExtraRetransmitTimeoutMultiplier)
 	}
 
-	return time.Duration(float64(retransmitTimeBase*int64(retransmitTimeBaseMultiplier))*retransmitMultiplier) * time.Millisecond
+	return time.Duration(float64(retransmitTimeBase*retransmitTimeBaseMultiplier)*retransmitMultiplier) * time.Millisecond
 }
 
 // AccessKey returns the servers sandbox access key
@@ -779,6 +1689,12 @@ func (pep *PRUDPEndPoint) Send(packet PacketInterface) {
 	pep.Server.Send(packet)
 }
 
+// SendWithConfirmation sends the packet using the endpoints server, and returns a DeliveryHandle
+// which is resolved once the packet has been acknowledged. See PRUDPServer.SendWithConfirmation
+func (pep *PRUDPEndPoint) SendWithConfirmation(packet PRUDPPacketInterface) *DeliveryHandle {
+	return pep.Server.SendWithConfirmation(packet)
+}
+
 // LibraryVersions returns the versions that the server has
 func (pep *PRUDPEndPoint) LibraryVersions() *LibraryVersions {
 	return pep.Server.LibraryVersions
@@ -807,15 +1723,24 @@ func (pep *PRUDPEndPoint) EnableVerboseRMC(enable bool) {
 // NewPRUDPEndPoint returns a new PRUDPEndPoint for a server on the provided stream ID
 func NewPRUDPEndPoint(streamID uint8) *PRUDPEndPoint {
 	pep := &PRUDPEndPoint{
-		StreamID:                     streamID,
-		DefaultStreamSettings:        NewStreamSettings(),
-		Connections:                  NewMutexMap[string, *PRUDPConnection](),
-		packetHandlers:               make(map[uint16]func(pep *PRUDPEndPoint, packet PRUDPPacketInterface)),
-		packetEventHandlers:          make(map[string][]func(PacketInterface)),
-		connectionEndedEventHandlers: make([]func(connection *PRUDPConnection), 0),
-		errorEventHandlers:           make([]func(err *Error), 0),
-		ConnectionIDCounter:          NewCounter[uint32](0),
-		IsSecureEndPoint:             false,
+		StreamID:                        streamID,
+		DefaultStreamSettings:           NewStreamSettings(),
+		Connections:                     NewMutexMap[string, *PRUDPConnection](),
+		packetHandlers:                  make(map[uint16]func(pep *PRUDPEndPoint, packet PRUDPPacketInterface)),
+		packetEventHandlers:             make(map[string][]func(PacketInterface)),
+		connectionEndedEventHandlers:    make([]func(connection *PRUDPConnection), 0),
+		connectionRejectedEventHandlers: make([]func(connection *PRUDPConnection, err *Error), 0),
+		connectionReplacedEventHandlers: make([]func(oldConnection, newConnection *PRUDPConnection), 0),
+		connectionMigratedEventHandlers: make([]func(connection *PRUDPConnection, oldAddress net.Addr), 0),
+		countedConnections:              make(map[*PRUDPConnection]types.PID),
+		connectionsByPID:                make(map[types.PID]int),
+		connectionLimitsMutex:           &sync.Mutex{},
+		connectionsBySession:            make(map[connectionSessionKey][]*PRUDPConnection),
+		connectionsBySessionMutex:       &sync.Mutex{},
+		disconnectAcknowledged:          make(chan struct{}, 1),
+		errorEventHandlers:              make([]func(err *Error), 0),
+		ConnectionIDCounter:             NewCounter[uint32](0),
+		IsSecureEndPoint:                false,
 	}
 
 	pep.packetHandlers[constants.SynPacket] = (*PRUDPEndPoint).handleSyn
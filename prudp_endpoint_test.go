@@ -0,0 +1,60 @@
+package nex
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/PretendoNetwork/nex-go/v2/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPRUDPEndPointMaxReassembledMessageSize(t *testing.T) {
+	network := simulator.NewNetwork(simulator.Settings{}, 11)
+
+	_, endpoint, client := newSimulatedConnection(t, network, 1)
+
+	errs := make(chan *Error, 10)
+	endpoint.OnError(func(err *Error) {
+		errs <- err
+	})
+
+	ended := make(chan struct{}, 1)
+	endpoint.OnConnectionEnded(func(_ *PRUDPConnection) {
+		ended <- struct{}{}
+	})
+
+	endpoint.Connections.Each(func(_ string, connection *PRUDPConnection) bool {
+		connection.Lock()
+		connection.StreamSettings.MaxReassembledMessageSize = 4000
+		connection.Unlock()
+
+		return false
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := client.Call(ctx, 0x64, 1, bytes.Repeat([]byte{1}, 3000))
+	assert.NoError(t, err)
+
+	callCtx, callCancel := context.WithTimeout(context.Background(), time.Second)
+	defer callCancel()
+
+	_, err = client.Call(callCtx, 0x64, 1, bytes.Repeat([]byte{2}, 5000))
+	assert.Error(t, err)
+
+	select {
+	case err := <-errs:
+		assert.Equal(t, ResultCodes.Transport.NoBuffer|uint32(errorMask), err.ResultCode)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Oversized message was not reported")
+	}
+
+	select {
+	case <-ended:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Connection was not disconnected")
+	}
+}
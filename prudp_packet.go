@@ -1,7 +1,10 @@
 package nex
 
 import (
+	"bytes"
 	"crypto/rc4"
+	"encoding/binary"
+	"net"
 	"time"
 
 	"github.com/PretendoNetwork/nex-go/v2/constants"
@@ -28,6 +31,12 @@ type PRUDPPacket struct {
 	sendCount              uint32
 	sentAt                 time.Time
 	timeout                *Timeout
+	delivery               *DeliveryHandle // * Set on packets sent with PRUDPServer.SendWithConfirmation
+
+	// * Decoded signatures are stored here, so inbound
+	// * packets do not need an allocation for each one
+	signatureBuffer           [16]byte
+	connectionSignatureBuffer [16]byte
 }
 
 // SetSender sets the Client who sent the packet
@@ -125,6 +134,11 @@ func (p *PRUDPPacket) SetSubstreamID(substreamID uint8) {
 	p.substreamID = substreamID
 }
 
+// Signature returns the packets signature
+func (p *PRUDPPacket) Signature() []byte {
+	return p.signature
+}
+
 func (p *PRUDPPacket) SetSignature(signature []byte) {
 	p.signature = signature
 }
@@ -214,10 +228,22 @@ func (p *PRUDPPacket) setTimeout(timeout *Timeout) {
 	p.timeout = timeout
 }
 
+func (p *PRUDPPacket) getDelivery() *DeliveryHandle {
+	return p.delivery
+}
+
+func (p *PRUDPPacket) setDelivery(delivery *DeliveryHandle) {
+	p.delivery = delivery
+}
+
 func (p *PRUDPPacket) processUnreliableCrypto() []byte {
 	// * Since unreliable DATA packets can come in out of
 	// * order, each packet uses a dedicated RC4 stream
-	uniqueKey := p.sender.UnreliablePacketBaseKey[:]
+	// * Copy the base key, otherwise every packet would
+	// * modify the key used by the next one
+	uniqueKey := make([]byte, len(p.sender.UnreliablePacketBaseKey))
+	copy(uniqueKey, p.sender.UnreliablePacketBaseKey)
+
 	uniqueKey[0] = byte((uint16(uniqueKey[0]) + p.sequenceID) & 0xFF)
 	uniqueKey[1] = byte((uint16(uniqueKey[1]) + (p.sequenceID >> 8)) & 0xFF)
 	uniqueKey[31] = byte((uniqueKey[31] + p.sessionID) & 0xFF)
@@ -229,3 +255,49 @@ func (p *PRUDPPacket) processUnreliableCrypto() []byte {
 
 	return ciphered
 }
+
+// setDecodedSignature copies a signature read from a stream into storage owned by the packet
+func (p *PRUDPPacket) setDecodedSignature(signature []byte) {
+	p.signature = append(p.signatureBuffer[:0], signature...)
+}
+
+// setDecodedConnectionSignature copies a connection signature read from a stream into storage owned by the packet
+func (p *PRUDPPacket) setDecodedConnectionSignature(connectionSignature []byte) {
+	p.connectionSignature = append(p.connectionSignatureBuffer[:0], connectionSignature...)
+}
+
+// setDecodedPayload copies a payload read from a stream, so the stream may be reused once decoding has finished
+func (p *PRUDPPacket) setDecodedPayload(payload []byte) {
+	p.payload = bytes.Clone(payload)
+}
+
+// appendPadded appends data zero padded, or truncated, to size bytes. Used for fixed size fields such as signatures
+func appendPadded(buffer, data []byte, size int) []byte {
+	if len(data) > size {
+		data = data[:size]
+	}
+
+	buffer = append(buffer, data...)
+
+	for i := len(data); i < size; i++ {
+		buffer = append(buffer, 0)
+	}
+
+	return buffer
+}
+
+// connectionSignatureData returns the address data connection signatures are calculated from. IPv4 addresses,
+// including IPv4 clients on dual-stack sockets, use their 4 byte form. IPv6 addresses use all 16 bytes, rather
+// than leaving out the IP and giving every IPv6 client on the same port the same signature
+func connectionSignatureData(ip net.IP, port int) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else {
+		ip = ip.To16()
+	}
+
+	data := make([]byte, 0, len(ip)+2)
+	data = append(data, ip...)
+
+	return binary.BigEndian.AppendUint16(data, uint16(port))
+}
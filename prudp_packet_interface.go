@@ -12,6 +12,7 @@ type PRUDPPacketInterface interface {
 	Copy() PRUDPPacketInterface
 	Version() int
 	Bytes() []byte
+	appendBytes(buffer []byte) []byte
 	SetSender(sender ConnectionInterface)
 	Sender() ConnectionInterface
 	Flags() uint16
@@ -43,7 +44,11 @@ type PRUDPPacketInterface interface {
 	setSentAt(time time.Time)
 	getTimeout() *Timeout
 	setTimeout(timeout *Timeout)
+	getDelivery() *DeliveryHandle
+	setDelivery(delivery *DeliveryHandle)
 	decode() error
+	release()
+	Signature() []byte
 	SetSignature(signature []byte)
 	CalculateConnectionSignature(addr net.Addr) ([]byte, error)
 	CalculateSignature(sessionKey, connectionSignature []byte) []byte
@@ -1,12 +1,14 @@
 package nex
 
 import (
+	"bytes"
 	"crypto/hmac"
 	"crypto/md5"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 
 	"github.com/PretendoNetwork/nex-go/v2/constants"
 )
@@ -93,6 +95,7 @@ func (p *PRUDPPacketLite) Copy() PRUDPPacketInterface {
 	}
 
 	copied.fragmentID = p.fragmentID
+	copied.delivery = p.delivery
 
 	if p.payload != nil {
 		copied.payload = append([]byte(nil), p.payload...)
@@ -182,34 +185,34 @@ func (p *PRUDPPacketLite) decode() error {
 		return errors.New("Failed to read PRUDPLite payload. Not have enough data")
 	}
 
-	p.payload = p.readStream.ReadBytesNext(int64(payloadLength))
+	p.setDecodedPayload(p.readStream.ReadBytesNext(int64(payloadLength)))
 
 	return nil
 }
 
 // Bytes encodes a PRUDPLite packet into a byte slice
 func (p *PRUDPPacketLite) Bytes() []byte {
-	options := p.encodeOptions()
-
-	stream := NewByteStreamOut(p.server.LibraryVersions, p.server.ByteStreamSettings)
+	return p.appendBytes(make([]byte, 0, 64+len(p.payload)))
+}
 
-	stream.WriteUInt8(0x80)
-	stream.WriteUInt8(uint8(len(options)))
-	stream.WriteUInt16LE(uint16(len(p.payload)))
-	stream.WriteUInt8(uint8((p.sourceVirtualPortStreamType << 4) | p.destinationVirtualPortStreamType))
-	stream.WriteUInt8(p.sourceVirtualPortStreamID)
-	stream.WriteUInt8(p.destinationVirtualPortStreamID)
-	stream.WriteUInt8(p.fragmentID)
-	stream.WriteUInt16LE(p.packetType | (p.flags << 4))
-	stream.WriteUInt16LE(p.sequenceID)
+// appendBytes encodes the packet onto the end of buffer
+func (p *PRUDPPacketLite) appendBytes(buffer []byte) []byte {
+	headerStart := len(buffer)
 
-	stream.Grow(int64(len(options)))
-	stream.WriteBytesNext(options)
+	buffer = append(buffer, 0x80, 0) // * The options length is filled in once they have been encoded
+	buffer = binary.LittleEndian.AppendUint16(buffer, uint16(len(p.payload)))
+	buffer = append(buffer, uint8((p.sourceVirtualPortStreamType<<4)|p.destinationVirtualPortStreamType))
+	buffer = append(buffer, p.sourceVirtualPortStreamID)
+	buffer = append(buffer, p.destinationVirtualPortStreamID)
+	buffer = append(buffer, p.fragmentID)
+	buffer = binary.LittleEndian.AppendUint16(buffer, p.packetType|(p.flags<<4))
+	buffer = binary.LittleEndian.AppendUint16(buffer, p.sequenceID)
 
-	stream.Grow(int64(len(p.payload)))
-	stream.WriteBytesNext(p.payload)
+	optionsStart := len(buffer)
+	buffer = p.appendOptions(buffer)
+	buffer[headerStart+1] = uint8(len(buffer) - optionsStart)
 
-	return stream.Bytes()
+	return append(buffer, p.payload...)
 }
 
 func (p *PRUDPPacketLite) decodeOptions() error {
@@ -218,7 +221,8 @@ func (p *PRUDPPacketLite) decodeOptions() error {
 	}
 
 	data := p.readStream.ReadBytesNext(int64(p.optionsLength))
-	optionsStream := NewByteStreamIn(data, p.server.LibraryVersions, p.server.ByteStreamSettings)
+	optionsStream := getByteStreamIn(data, p.server.LibraryVersions, p.server.ByteStreamSettings)
+	defer putByteStreamIn(optionsStream)
 
 	for optionsStream.Remaining() > 0 {
 		optionID, err := optionsStream.ReadUInt8()
@@ -243,7 +247,7 @@ func (p *PRUDPPacketLite) decodeOptions() error {
 				if optionsStream.Remaining() < uint64(optionSize) {
 					err = errors.New("Failed to read connection signature. Not have enough data")
 				} else {
-					p.connectionSignature = optionsStream.ReadBytesNext(int64(optionSize))
+					p.setDecodedConnectionSignature(optionsStream.ReadBytesNext(int64(optionSize)))
 				}
 			}
 
@@ -269,7 +273,7 @@ func (p *PRUDPPacketLite) decodeOptions() error {
 				if optionsStream.Remaining() < uint64(optionSize) {
 					err = errors.New("Failed to read lite signature. Not have enough data")
 				} else {
-					p.liteSignature = optionsStream.ReadBytesNext(int64(optionSize))
+					p.liteSignature = bytes.Clone(optionsStream.ReadBytesNext(int64(optionSize)))
 				}
 			}
 		}
@@ -285,48 +289,35 @@ func (p *PRUDPPacketLite) decodeOptions() error {
 	return nil
 }
 
-func (p *PRUDPPacketLite) encodeOptions() []byte {
-	optionsStream := NewByteStreamOut(p.server.LibraryVersions, p.server.ByteStreamSettings)
-
+func (p *PRUDPPacketLite) appendOptions(buffer []byte) []byte {
 	if p.packetType == constants.SynPacket || p.packetType == constants.ConnectPacket {
-		optionsStream.WriteUInt8(0)
-		optionsStream.WriteUInt8(4)
-		optionsStream.WriteUInt32LE(p.minorVersion | (p.supportedFunctions << 8))
+		buffer = append(buffer, 0, 4)
+		buffer = binary.LittleEndian.AppendUint32(buffer, p.minorVersion|(p.supportedFunctions<<8))
 
 		if p.packetType == constants.SynPacket && p.HasFlag(constants.PacketFlagAck) {
-			optionsStream.WriteUInt8(1)
-			optionsStream.WriteUInt8(16)
-			optionsStream.Grow(16)
-			optionsStream.WriteBytesNext(p.connectionSignature)
+			buffer = append(buffer, 1, 16)
+			buffer = appendPadded(buffer, p.connectionSignature, 16)
 		}
 
 		if p.packetType == constants.ConnectPacket && !p.HasFlag(constants.PacketFlagAck) {
-			optionsStream.WriteUInt8(1)
-			optionsStream.WriteUInt8(16)
-			optionsStream.Grow(16)
-			optionsStream.WriteBytesNext(p.liteSignature)
+			buffer = append(buffer, 1, 16)
+			buffer = appendPadded(buffer, p.liteSignature, 16)
 		}
 	}
 
-	return optionsStream.Bytes()
+	return buffer
 }
 
 func (p *PRUDPPacketLite) CalculateConnectionSignature(addr net.Addr) ([]byte, error) {
-	var ip net.IP
-	var port int
+	var data []byte
 
 	switch v := addr.(type) {
 	case *net.TCPAddr:
-		ip = v.IP.To4()
-		port = v.Port
+		data = connectionSignatureData(v.IP, v.Port)
 	default:
 		return nil, fmt.Errorf("Unsupported network type: %T", addr)
 	}
 
-	portBytes := make([]byte, 2)
-	binary.BigEndian.PutUint16(portBytes, uint16(port))
-
-	data := append(ip, portBytes...)
 	hash := hmac.New(md5.New, p.server.PRUDPv1ConnectionSignatureKey)
 	hash.Write(data)
 
@@ -338,20 +329,34 @@ func (p *PRUDPPacketLite) CalculateSignature(sessionKey, connectionSignature []b
 	return make([]byte, 0)
 }
 
+// release resets the packet and returns it to the pool. The packet must not be used after this
+func (p *PRUDPPacketLite) release() {
+	*p = PRUDPPacketLite{}
+	prudpPacketLitePool.Put(p)
+}
+
+var prudpPacketLitePool = sync.Pool{
+	New: func() any {
+		return &PRUDPPacketLite{}
+	},
+}
+
 // NewPRUDPPacketLite creates and returns a new PacketLite using the provided Client and stream
 func NewPRUDPPacketLite(server *PRUDPServer, connection *PRUDPConnection, readStream *ByteStreamIn) (*PRUDPPacketLite, error) {
-	packet := &PRUDPPacketLite{
-		PRUDPPacket: PRUDPPacket{
-			sender:     connection,
-			readStream: readStream,
-		},
-	}
+	packet := prudpPacketLitePool.Get().(*PRUDPPacketLite)
 
 	packet.server = server
+	packet.sender = connection
+	packet.readStream = readStream
 
 	if readStream != nil {
 		err := packet.decode()
+
+		// * Everything the packet keeps has been copied out of the stream
+		packet.readStream = nil
+
 		if err != nil {
+			packet.release()
 			return nil, fmt.Errorf("Failed to decode PRUDPLite packet. %s", err.Error())
 		}
 	}
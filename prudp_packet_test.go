@@ -0,0 +1,217 @@
+package nex
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/PretendoNetwork/nex-go/v2/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+// discardPacketConn is a socket which drops everything sent to it
+type discardPacketConn struct {
+	net.PacketConn
+}
+
+func (discardPacketConn) WriteTo(p []byte, _ net.Addr) (int, error) {
+	return len(p), nil
+}
+
+func newTestDataPacket(server *PRUDPServer, prudpVersion int, payload []byte) PRUDPPacketInterface {
+	var packet PRUDPPacketInterface
+
+	switch prudpVersion {
+	case 0:
+		packet, _ = NewPRUDPPacketV0(server, nil, nil)
+		packet.SetSignature([]byte{1, 2, 3, 4})
+	case 1:
+		packet, _ = NewPRUDPPacketV1(server, nil, nil)
+		packet.SetSignature(bytes.Repeat([]byte{0xAA}, 16))
+	case 2:
+		packet, _ = NewPRUDPPacketLite(server, nil, nil)
+	}
+
+	packet.SetType(constants.DataPacket)
+	packet.AddFlag(constants.PacketFlagReliable)
+	packet.AddFlag(constants.PacketFlagNeedsAck)
+	packet.SetSourceVirtualPortStreamType(constants.StreamTypeRVSecure)
+	packet.SetSourceVirtualPortStreamID(15)
+	packet.SetDestinationVirtualPortStreamType(constants.StreamTypeRVSecure)
+	packet.SetDestinationVirtualPortStreamID(1)
+	packet.SetSequenceID(0x1234)
+	packet.SetPayload(payload)
+
+	return packet
+}
+
+func decodeTestPackets(server *PRUDPServer, prudpVersion int, data []byte) []PRUDPPacketInterface {
+	readStream := getByteStreamIn(data, server.LibraryVersions, server.ByteStreamSettings)
+	defer putByteStreamIn(readStream)
+
+	var packets []PRUDPPacketInterface
+
+	switch prudpVersion {
+	case 0:
+		packets, _ = NewPRUDPPacketsV0(server, nil, readStream)
+	case 1:
+		packets, _ = NewPRUDPPacketsV1(server, nil, readStream)
+	case 2:
+		packets, _ = NewPRUDPPacketsLite(server, nil, readStream)
+	}
+
+	return packets
+}
+
+func TestPRUDPPacketDecodeCopiesData(t *testing.T) {
+	server := NewPRUDPServer()
+
+	for _, prudpVersion := range []int{0, 1, 2} {
+		payload := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+		data := newTestDataPacket(server, prudpVersion, payload).Bytes()
+		original := append([]byte(nil), data...)
+
+		packets := decodeTestPackets(server, prudpVersion, data)
+		if !assert.Len(t, packets, 1) {
+			continue
+		}
+
+		// * Reusing the datagram buffer must not change decoded packets
+		clear(data)
+
+		assert.Equal(t, payload, packets[0].Payload())
+		assert.Equal(t, original, packets[0].Bytes())
+	}
+}
+
+func TestPRUDPPacketConcurrentEncode(t *testing.T) {
+	server := NewPRUDPServer()
+
+	for _, prudpVersion := range []int{0, 1, 2} {
+		packet := newTestDataPacket(server, prudpVersion, []byte{1, 2, 3, 4})
+		expected := packet.Bytes()
+
+		// * A packet being resent may be encoded by more than one goroutine at once
+		var wg sync.WaitGroup
+
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				assert.Equal(t, expected, packet.Bytes())
+			}()
+		}
+
+		wg.Wait()
+	}
+}
+
+func BenchmarkPRUDPPacketDecode(b *testing.B) {
+	server := NewPRUDPServer()
+
+	for _, prudpVersion := range []int{0, 1, 2} {
+		data := newTestDataPacket(server, prudpVersion, bytes.Repeat([]byte{0xFF}, 256)).Bytes()
+
+		b.Run(fmt.Sprintf("v%d", prudpVersion), func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				decodeTestPackets(server, prudpVersion, data)
+			}
+		})
+	}
+}
+
+func BenchmarkPRUDPPacketEncode(b *testing.B) {
+	server := NewPRUDPServer()
+
+	for _, prudpVersion := range []int{0, 1, 2} {
+		packet := newTestDataPacket(server, prudpVersion, bytes.Repeat([]byte{0xFF}, 256))
+
+		b.Run(fmt.Sprintf("v%d", prudpVersion), func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				buffer := getPacketBuffer()
+				*buffer = packet.appendBytes(*buffer)
+				putPacketBuffer(buffer)
+			}
+		})
+	}
+}
+
+func BenchmarkPRUDPEndPointAcknowledgePacket(b *testing.B) {
+	for _, prudpVersion := range []int{0, 1} {
+		server := NewPRUDPServer()
+		server.udpSocket = discardPacketConn{}
+
+		endpoint := NewPRUDPEndPoint(1)
+		server.BindPRUDPEndPoint(endpoint)
+
+		connection := NewPRUDPConnection(NewSocketConnection(server, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 60000}, nil))
+		connection.endpoint = endpoint
+		connection.StreamSettings = endpoint.DefaultStreamSettings.Copy()
+		connection.SetSessionKey(make([]byte, 16))
+
+		// * Acknowledgements make up most of what a busy server sends
+		packet := newTestDataPacket(server, prudpVersion, bytes.Repeat([]byte{0xFF}, 256))
+		packet.SetSender(connection)
+
+		b.Run(fmt.Sprintf("v%d", prudpVersion), func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				endpoint.AcknowledgePacket(packet)
+			}
+		})
+	}
+}
+
+func TestPRUDPPacketConnectionSignatureIPv6(t *testing.T) {
+	server := NewPRUDPServer()
+	server.initPRUDPv1ConnectionSignatureKey()
+
+	v0, _ := NewPRUDPPacketV0(server, nil, nil)
+	v1, _ := NewPRUDPPacketV1(server, nil, nil)
+
+	for _, packet := range []PRUDPPacketInterface{v0, v1} {
+		signature := func(address string) []byte {
+			udpAddress, err := net.ResolveUDPAddr("udp", address)
+			assert.NoError(t, err)
+
+			signature, err := packet.CalculateConnectionSignature(udpAddress)
+			assert.NoError(t, err)
+
+			return signature
+		}
+
+		// * IPv4 clients on dual-stack sockets keep their IPv4 signature
+		assert.Equal(t, signature("127.0.0.1:60000"), signature("[::ffff:127.0.0.1]:60000"))
+
+		assert.NotEqual(t, signature("[2001:db8::1]:60000"), signature("[2001:db8::2]:60000"))
+		assert.NotEqual(t, signature("[2001:db8::1]:60000"), signature("[2001:db8::1]:60001"))
+	}
+}
+
+func TestPRUDPPacketUnreliableCryptoKeepsBaseKey(t *testing.T) {
+	server := NewPRUDPServer()
+	connection := NewPRUDPConnection(NewSocketConnection(server, &net.UDPAddr{}, nil))
+	connection.SetSessionKey(bytes.Repeat([]byte{0x11}, 16))
+
+	baseKey := bytes.Clone(connection.UnreliablePacketBaseKey)
+
+	packet, _ := NewPRUDPPacketV1(server, connection, nil)
+	packet.SetSequenceID(5)
+	packet.SetSessionID(1)
+	packet.SetPayload([]byte{1, 2, 3, 4})
+
+	// * Every packet is encrypted with a key derived from the same base key,
+	// * so processing a packet must give the same result each time
+	encrypted := packet.processUnreliableCrypto()
+	assert.Equal(t, encrypted, packet.processUnreliableCrypto())
+	assert.Equal(t, baseKey, connection.UnreliablePacketBaseKey)
+}
@@ -1,13 +1,13 @@
 package nex
 
 import (
-	"crypto/hmac"
 	"crypto/md5"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
 	"slices"
+	"sync"
 
 	"github.com/PretendoNetwork/nex-go/v2/constants"
 )
@@ -15,6 +15,7 @@ import (
 // PRUDPPacketV0 represents a PRUDPv0 packet
 type PRUDPPacketV0 struct {
 	PRUDPPacket
+	checksumValid bool // * Whether the checksum of an inbound packet matched. Only set if PRUDPV0Settings.VerifyChecksums is enabled
 }
 
 // Copy copies the packet into a new PRUDPPacketV0
@@ -42,6 +43,7 @@ func (p *PRUDPPacketV0) Copy() PRUDPPacketInterface {
 	}
 
 	copied.fragmentID = p.fragmentID
+	copied.delivery = p.delivery
 
 	if p.payload != nil {
 		copied.payload = append([]byte(nil), p.payload...)
@@ -105,7 +107,7 @@ func (p *PRUDPPacketV0) decode() error {
 		return fmt.Errorf("Failed to read PRUDPv0 session ID. %s", err.Error())
 	}
 
-	p.signature = p.readStream.ReadBytesNext(4)
+	p.setDecodedSignature(p.readStream.ReadBytesNext(4))
 
 	p.sequenceID, err = p.readStream.ReadUInt16LE()
 	if err != nil {
@@ -117,7 +119,7 @@ func (p *PRUDPPacketV0) decode() error {
 			return errors.New("Failed to read PRUDPv0 connection signature. Not have enough data")
 		}
 
-		p.connectionSignature = p.readStream.ReadBytesNext(4)
+		p.setDecodedConnectionSignature(p.readStream.ReadBytesNext(4))
 	}
 
 	if p.packetType == constants.DataPacket {
@@ -155,7 +157,7 @@ func (p *PRUDPPacketV0) decode() error {
 		return errors.New("Failed to read PRUDPv0 payload. Not have enough data")
 	}
 
-	p.payload = p.readStream.ReadBytesNext(int64(payloadSize))
+	p.setDecodedPayload(p.readStream.ReadBytesNext(int64(payloadSize)))
 
 	if server.PRUDPV0Settings.UseEnhancedChecksum && p.readStream.Remaining() < 4 {
 		return errors.New("Failed to read PRUDPv0 checksum. Not have enough data")
@@ -179,61 +181,66 @@ func (p *PRUDPPacketV0) decode() error {
 		return fmt.Errorf("Failed to read PRUDPv0 checksum. %s", err.Error())
 	}
 
-	calculatedChecksum := p.server.PRUDPV0Settings.ChecksumCalculator(p, checksumData)
-
-	if checksum != calculatedChecksum {
-		return errors.New("Invalid PRUDPv0 checksum")
+	// * The stream is reused once decoding has finished,
+	// * so the checksum has to be calculated now
+	if server.PRUDPV0Settings.VerifyChecksums {
+		p.checksumValid = checksum == server.PRUDPV0Settings.ChecksumCalculator(p, checksumData)
 	}
 
 	return nil
 }
 
+// verifyChecksum checks the checksum of an inbound packet.
+// The checksum is checked by the endpoint, rather than when decoding, so invalid packets can be reported to it
+func (p *PRUDPPacketV0) verifyChecksum() bool {
+	return !p.server.PRUDPV0Settings.VerifyChecksums || p.checksumValid
+}
+
 // Bytes encodes a PRUDPv0 packet into a byte slice
 func (p *PRUDPPacketV0) Bytes() []byte {
+	return p.appendBytes(make([]byte, 0, 32+len(p.payload)))
+}
+
+// appendBytes encodes the packet onto the end of buffer
+func (p *PRUDPPacketV0) appendBytes(buffer []byte) []byte {
 	server := p.server
-	stream := NewByteStreamOut(server.LibraryVersions, server.ByteStreamSettings)
+	start := len(buffer)
 
-	stream.WriteUInt8(uint8(p.sourceVirtualPort))
-	stream.WriteUInt8(uint8(p.destinationVirtualPort))
+	buffer = append(buffer, uint8(p.sourceVirtualPort), uint8(p.destinationVirtualPort))
 
 	if server.PRUDPV0Settings.IsQuazalMode {
-		stream.WriteUInt8(uint8(p.packetType | (p.flags << 3)))
+		buffer = append(buffer, uint8(p.packetType|(p.flags<<3)))
 	} else {
-		stream.WriteUInt16LE(p.packetType | (p.flags << 4))
+		buffer = binary.LittleEndian.AppendUint16(buffer, p.packetType|(p.flags<<4))
 	}
 
-	stream.WriteUInt8(p.sessionID)
-	stream.Grow(int64(len(p.signature)))
-	stream.WriteBytesNext(p.signature)
-	stream.WriteUInt16LE(p.sequenceID)
+	buffer = append(buffer, p.sessionID)
+	buffer = append(buffer, p.signature...)
+	buffer = binary.LittleEndian.AppendUint16(buffer, p.sequenceID)
 
 	if p.packetType == constants.SynPacket || p.packetType == constants.ConnectPacket {
-		stream.Grow(int64(len(p.connectionSignature)))
-		stream.WriteBytesNext(p.connectionSignature)
+		buffer = append(buffer, p.connectionSignature...)
 	}
 
 	if p.packetType == constants.DataPacket {
-		stream.WriteUInt8(p.fragmentID)
+		buffer = append(buffer, p.fragmentID)
 	}
 
 	if p.HasFlag(constants.PacketFlagHasSize) {
-		stream.WriteUInt16LE(uint16(len(p.payload)))
+		buffer = binary.LittleEndian.AppendUint16(buffer, uint16(len(p.payload)))
 	}
 
-	if len(p.payload) > 0 {
-		stream.Grow(int64(len(p.payload)))
-		stream.WriteBytesNext(p.payload)
-	}
+	buffer = append(buffer, p.payload...)
 
-	checksum := p.server.PRUDPV0Settings.ChecksumCalculator(p, stream.Bytes())
+	checksum := server.PRUDPV0Settings.ChecksumCalculator(p, buffer[start:])
 
 	if server.PRUDPV0Settings.UseEnhancedChecksum {
-		stream.WriteUInt32LE(checksum)
+		buffer = binary.LittleEndian.AppendUint32(buffer, checksum)
 	} else {
-		stream.WriteUInt8(uint8(checksum))
+		buffer = append(buffer, uint8(checksum))
 	}
 
-	return stream.Bytes()
+	return buffer
 }
 
 // CalculateConnectionSignature calculates connection signature using the registered calculator.
@@ -246,21 +253,35 @@ func (p *PRUDPPacketV0) CalculateSignature(sessionKey, connectionSignature []byt
 	return p.server.PRUDPV0Settings.SignatureCalculator(p, sessionKey, connectionSignature)
 }
 
+// release resets the packet and returns it to the pool. The packet must not be used after this
+func (p *PRUDPPacketV0) release() {
+	*p = PRUDPPacketV0{}
+	prudpPacketV0Pool.Put(p)
+}
+
+var prudpPacketV0Pool = sync.Pool{
+	New: func() any {
+		return &PRUDPPacketV0{}
+	},
+}
+
 // NewPRUDPPacketV0 creates and returns a new PacketV0 using the provided Client and stream
 func NewPRUDPPacketV0(server *PRUDPServer, connection *PRUDPConnection, readStream *ByteStreamIn) (*PRUDPPacketV0, error) {
-	packet := &PRUDPPacketV0{
-		PRUDPPacket: PRUDPPacket{
-			sender:     connection,
-			readStream: readStream,
-			version:    0,
-		},
-	}
+	packet := prudpPacketV0Pool.Get().(*PRUDPPacketV0)
 
 	packet.server = server
+	packet.sender = connection
+	packet.readStream = readStream
+	packet.version = 0
 
 	if readStream != nil {
 		err := packet.decode()
+
+		// * Everything the packet keeps has been copied out of the stream
+		packet.readStream = nil
+
 		if err != nil {
+			packet.release()
 			return nil, fmt.Errorf("Failed to decode PRUDPv0 packet. %s", err.Error())
 		}
 	}
@@ -285,21 +306,15 @@ func NewPRUDPPacketsV0(server *PRUDPServer, connection *PRUDPConnection, readStr
 }
 
 func defaultPRUDPv0ConnectionSignature(packet *PRUDPPacketV0, addr net.Addr) ([]byte, error) {
-	var ip net.IP
-	var port int
+	var data []byte
 
 	switch v := addr.(type) {
 	case *net.UDPAddr:
-		ip = v.IP.To4()
-		port = v.Port
+		data = connectionSignatureData(v.IP, v.Port)
 	default:
 		return nil, fmt.Errorf("Unsupported network type: %T", addr)
 	}
 
-	portBytes := make([]byte, 2)
-	binary.BigEndian.PutUint16(portBytes, uint16(port))
-
-	data := append(ip, portBytes...)
 	hash := md5.Sum(data)
 	signatureBytes := hash[:4]
 
@@ -328,62 +343,61 @@ func defaultPRUDPv0CalculateSignature(packet *PRUDPPacketV0, sessionKey, connect
 
 func defaultPRUDPv0CalculateDataSignature(packet *PRUDPPacketV0, sessionKey []byte) []byte {
 	server := packet.server
-	data := packet.payload
 
-	if server.AccessKey != "ridfebb9" {
-		header := []byte{0, 0, packet.fragmentID}
-		binary.LittleEndian.PutUint16(header[:2], packet.sequenceID)
+	// * Games other than the friends server sign the session key
+	// * and part of the header along with the payload
+	signsHeader := server.AccessKey != "ridfebb9"
 
-		data = append(sessionKey, header...)
-		data = append(data, packet.payload...)
+	if !signsHeader && len(packet.payload) == 0 {
+		return []byte{0x78, 0x56, 0x34, 0x12}
 	}
 
-	if len(data) > 0 {
-		key := md5.Sum([]byte(server.AccessKey))
-		mac := hmac.New(md5.New, key[:])
+	mac := getSignatureMAC(md5.Sum([]byte(server.AccessKey)))
+	defer signatureMACPool.Put(mac)
 
-		mac.Write(data)
+	if signsHeader {
+		var header [3]byte
 
-		digest := mac.Sum(nil)
+		binary.LittleEndian.PutUint16(header[:2], packet.sequenceID)
+		header[2] = packet.fragmentID
 
-		return digest[:4]
+		mac.Write(sessionKey)
+		mac.Write(header[:])
 	}
 
-	return []byte{0x78, 0x56, 0x34, 0x12}
+	mac.Write(packet.payload)
+
+	return mac.Sum(nil)[:4]
 }
 
 func defaultPRUDPv0CalculateChecksum(packet *PRUDPPacketV0, data []byte) uint32 {
 	server := packet.server
 	checksum := sum[byte, uint32]([]byte(server.AccessKey))
 
-	if server.PRUDPV0Settings.UseEnhancedChecksum {
-		padSize := (len(data) + 3) &^ 3
-		data = append(data, make([]byte, padSize-len(data))...)
-		words := make([]uint32, len(data)/4)
-
-		for i := 0; i < len(data)/4; i++ {
-			words[i] = binary.LittleEndian.Uint32(data[i*4 : (i+1)*4])
-		}
+	var words uint32
 
-		result := (checksum & 0xFF) + sum[uint32, uint32](words)
+	for i := 0; i+4 <= len(data); i += 4 {
+		words += binary.LittleEndian.Uint32(data[i : i+4])
+	}
 
-		return result & 0xFFFFFFFF
-	} else {
-		words := make([]uint32, len(data)/4)
+	remaining := data[len(data)&^3:]
 
-		for i := 0; i < len(data)/4; i++ {
-			words[i] = binary.LittleEndian.Uint32(data[i*4 : (i+1)*4])
-		}
+	if server.PRUDPV0Settings.UseEnhancedChecksum {
+		// * The data is zero padded to a multiple of 4 bytes
+		var lastWord [4]byte
 
-		temp := sum[uint32, uint32](words) & 0xFFFFFFFF
+		copy(lastWord[:], remaining)
 
-		checksum += sum[byte, uint32](data[len(data)&^3:])
+		words += binary.LittleEndian.Uint32(lastWord[:])
 
-		tempBytes := make([]byte, 4)
+		return (checksum & 0xFF) + words
+	} else {
+		var wordsBytes [4]byte
 
-		binary.LittleEndian.PutUint32(tempBytes, temp)
+		binary.LittleEndian.PutUint32(wordsBytes[:], words)
 
-		checksum += sum[byte, uint32](tempBytes)
+		checksum += sum[byte, uint32](remaining)
+		checksum += sum[byte, uint32](wordsBytes[:])
 
 		return checksum & 0xFF
 	}
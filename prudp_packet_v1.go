@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"sync"
 
 	"github.com/PretendoNetwork/nex-go/v2/constants"
 )
@@ -48,6 +49,7 @@ func (p *PRUDPPacketV1) Copy() PRUDPPacketInterface {
 	}
 
 	copied.fragmentID = p.fragmentID
+	copied.delivery = p.delivery
 
 	if p.payload != nil {
 		copied.payload = append([]byte(nil), p.payload...)
@@ -93,7 +95,7 @@ func (p *PRUDPPacketV1) decode() error {
 		return errors.New("Failed to read PRUDPv1 signature. Not have enough data")
 	}
 
-	p.signature = p.readStream.ReadBytesNext(16)
+	p.setDecodedSignature(p.readStream.ReadBytesNext(16))
 
 	err = p.decodeOptions()
 	if err != nil {
@@ -104,37 +106,32 @@ func (p *PRUDPPacketV1) decode() error {
 		return errors.New("Failed to read PRUDPv1 payload. Not have enough data")
 	}
 
-	p.payload = p.readStream.ReadBytesNext(int64(p.payloadLength))
+	p.setDecodedPayload(p.readStream.ReadBytesNext(int64(p.payloadLength)))
 
 	return nil
 }
 
 // Bytes encodes a PRUDPv1 packet into a byte slice
 func (p *PRUDPPacketV1) Bytes() []byte {
-	options := p.encodeOptions()
-
-	p.optionsLength = uint8(len(options))
-
-	header := p.encodeHeader()
-
-	stream := NewByteStreamOut(p.server.LibraryVersions, p.server.ByteStreamSettings)
-
-	stream.Grow(2)
-	stream.WriteBytesNext([]byte{0xEA, 0xD0})
+	return p.appendBytes(make([]byte, 0, 64+len(p.payload)))
+}
 
-	stream.Grow(12)
-	stream.WriteBytesNext(header)
+// appendBytes encodes the packet onto the end of buffer
+func (p *PRUDPPacketV1) appendBytes(buffer []byte) []byte {
+	buffer = append(buffer, 0xEA, 0xD0)
 
-	stream.Grow(16)
-	stream.WriteBytesNext(p.signature)
+	headerStart := len(buffer)
+	buffer = p.appendHeader(buffer)
+	buffer = appendPadded(buffer, p.signature, 16)
 
-	stream.Grow(int64(p.optionsLength))
-	stream.WriteBytesNext(options)
+	optionsStart := len(buffer)
+	buffer = p.appendOptions(buffer)
 
-	stream.Grow(int64(len(p.payload)))
-	stream.WriteBytesNext(p.payload)
+	// * The options length is only known once they have been encoded. It is not stored
+	// * on the packet, so packets can be encoded by more than one goroutine at once
+	buffer[headerStart+1] = uint8(len(buffer) - optionsStart)
 
-	return stream.Bytes()
+	return append(buffer, p.payload...)
 }
 
 func (p *PRUDPPacketV1) decodeHeader() error {
@@ -202,20 +199,18 @@ func (p *PRUDPPacketV1) decodeHeader() error {
 	return nil
 }
 
-func (p *PRUDPPacketV1) encodeHeader() []byte {
-	stream := NewByteStreamOut(p.server.LibraryVersions, p.server.ByteStreamSettings)
-
-	stream.WriteUInt8(1) // * Version
-	stream.WriteUInt8(p.optionsLength)
-	stream.WriteUInt16LE(uint16(len(p.payload)))
-	stream.WriteUInt8(uint8(p.sourceVirtualPort))
-	stream.WriteUInt8(uint8(p.destinationVirtualPort))
-	stream.WriteUInt16LE(p.packetType | (p.flags << 4)) // TODO - Does QRV also encode it this way in PRUDPv1?
-	stream.WriteUInt8(p.sessionID)
-	stream.WriteUInt8(p.substreamID)
-	stream.WriteUInt16LE(p.sequenceID)
-
-	return stream.Bytes()
+func (p *PRUDPPacketV1) appendHeader(buffer []byte) []byte {
+	buffer = append(buffer, 1) // * Version
+	buffer = append(buffer, 0) // * The options length is filled in by appendBytes. Signatures do not include it
+	buffer = binary.LittleEndian.AppendUint16(buffer, uint16(len(p.payload)))
+	buffer = append(buffer, uint8(p.sourceVirtualPort))
+	buffer = append(buffer, uint8(p.destinationVirtualPort))
+	buffer = binary.LittleEndian.AppendUint16(buffer, p.packetType|(p.flags<<4)) // TODO - Does QRV also encode it this way in PRUDPv1?
+	buffer = append(buffer, p.sessionID)
+	buffer = append(buffer, p.substreamID)
+	buffer = binary.LittleEndian.AppendUint16(buffer, p.sequenceID)
+
+	return buffer
 }
 
 func (p *PRUDPPacketV1) decodeOptions() error {
@@ -224,7 +219,8 @@ func (p *PRUDPPacketV1) decodeOptions() error {
 	}
 
 	data := p.readStream.ReadBytesNext(int64(p.optionsLength))
-	optionsStream := NewByteStreamIn(data, p.server.LibraryVersions, p.server.ByteStreamSettings)
+	optionsStream := getByteStreamIn(data, p.server.LibraryVersions, p.server.ByteStreamSettings)
+	defer putByteStreamIn(optionsStream)
 
 	for optionsStream.Remaining() > 0 {
 		optionID, err := optionsStream.ReadUInt8()
@@ -249,7 +245,7 @@ func (p *PRUDPPacketV1) decodeOptions() error {
 				if optionsStream.Remaining() < 16 {
 					err = errors.New("Not have enough data")
 				} else {
-					p.connectionSignature = optionsStream.ReadBytesNext(16)
+					p.setDecodedConnectionSignature(optionsStream.ReadBytesNext(16))
 				}
 			}
 
@@ -281,18 +277,13 @@ func (p *PRUDPPacketV1) decodeOptions() error {
 	return nil
 }
 
-func (p *PRUDPPacketV1) encodeOptions() []byte {
-	optionsStream := NewByteStreamOut(p.server.LibraryVersions, p.server.ByteStreamSettings)
-
+func (p *PRUDPPacketV1) appendOptions(buffer []byte) []byte {
 	if p.packetType == constants.SynPacket || p.packetType == constants.ConnectPacket {
-		optionsStream.WriteUInt8(0)
-		optionsStream.WriteUInt8(4)
-		optionsStream.WriteUInt32LE(p.MinorVersion | (p.SupportedFunctions << 8))
+		buffer = append(buffer, 0, 4)
+		buffer = binary.LittleEndian.AppendUint32(buffer, p.MinorVersion|(p.SupportedFunctions<<8))
 
-		optionsStream.WriteUInt8(1)
-		optionsStream.WriteUInt8(16)
-		optionsStream.Grow(16)
-		optionsStream.WriteBytesNext(p.connectionSignature)
+		buffer = append(buffer, 1, 16)
+		buffer = appendPadded(buffer, p.connectionSignature, 16)
 
 		// * Encoded here for NintendoClients compatibility.
 		// * The order of these options should not matter,
@@ -303,23 +294,18 @@ func (p *PRUDPPacketV1) encodeOptions() []byte {
 		// * parsed, though, order REALLY doesn't matter.
 		// * NintendoClients expects option 3 before 4, though
 		if p.packetType == constants.ConnectPacket {
-			optionsStream.WriteUInt8(3)
-			optionsStream.WriteUInt8(2)
-			optionsStream.WriteUInt16LE(p.InitialUnreliableSequenceID)
+			buffer = append(buffer, 3, 2)
+			buffer = binary.LittleEndian.AppendUint16(buffer, p.InitialUnreliableSequenceID)
 		}
 
-		optionsStream.WriteUInt8(4)
-		optionsStream.WriteUInt8(1)
-		optionsStream.WriteUInt8(p.MaximumSubstreamID)
+		buffer = append(buffer, 4, 1, p.MaximumSubstreamID)
 	}
 
 	if p.packetType == constants.DataPacket {
-		optionsStream.WriteUInt8(2)
-		optionsStream.WriteUInt8(1)
-		optionsStream.WriteUInt8(p.fragmentID)
+		buffer = append(buffer, 2, 1, p.fragmentID)
 	}
 
-	return optionsStream.Bytes()
+	return buffer
 }
 
 func (p *PRUDPPacketV1) CalculateConnectionSignature(addr net.Addr) ([]byte, error) {
@@ -330,21 +316,35 @@ func (p *PRUDPPacketV1) CalculateSignature(sessionKey, connectionSignature []byt
 	return p.server.PRUDPV1Settings.SignatureCalculator(p, sessionKey, connectionSignature)
 }
 
+// release resets the packet and returns it to the pool. The packet must not be used after this
+func (p *PRUDPPacketV1) release() {
+	*p = PRUDPPacketV1{}
+	prudpPacketV1Pool.Put(p)
+}
+
+var prudpPacketV1Pool = sync.Pool{
+	New: func() any {
+		return &PRUDPPacketV1{}
+	},
+}
+
 // NewPRUDPPacketV1 creates and returns a new PacketV1 using the provided Client and stream
 func NewPRUDPPacketV1(server *PRUDPServer, connection *PRUDPConnection, readStream *ByteStreamIn) (*PRUDPPacketV1, error) {
-	packet := &PRUDPPacketV1{
-		PRUDPPacket: PRUDPPacket{
-			sender:     connection,
-			readStream: readStream,
-			version:    1,
-		},
-	}
+	packet := prudpPacketV1Pool.Get().(*PRUDPPacketV1)
 
 	packet.server = server
+	packet.sender = connection
+	packet.readStream = readStream
+	packet.version = 1
 
 	if readStream != nil {
 		err := packet.decode()
+
+		// * Everything the packet keeps has been copied out of the stream
+		packet.readStream = nil
+
 		if err != nil {
+			packet.release()
 			return nil, fmt.Errorf("Failed to decode PRUDPv1 packet. %s", err.Error())
 		}
 	}
@@ -369,21 +369,15 @@ func NewPRUDPPacketsV1(server *PRUDPServer, connection *PRUDPConnection, readStr
 }
 
 func defaultPRUDPv1ConnectionSignature(packet *PRUDPPacketV1, addr net.Addr) ([]byte, error) {
-	var ip net.IP
-	var port int
+	var data []byte
 
 	switch v := addr.(type) {
 	case *net.UDPAddr:
-		ip = v.IP.To4()
-		port = v.Port
+		data = connectionSignatureData(v.IP, v.Port)
 	default:
 		return nil, fmt.Errorf("Unsupported network type: %T", addr)
 	}
 
-	portBytes := make([]byte, 2)
-	binary.BigEndian.PutUint16(portBytes, uint16(port))
-
-	data := append(ip, portBytes...)
 	hash := hmac.New(md5.New, packet.server.PRUDPv1ConnectionSignatureKey)
 	hash.Write(data)
 
@@ -392,15 +386,22 @@ func defaultPRUDPv1ConnectionSignature(packet *PRUDPPacketV1, addr net.Addr) ([]
 
 func defaultPRUDPv1CalculateSignature(packet *PRUDPPacketV1, sessionKey, connectionSignature []byte) []byte {
 	accessKeyBytes := []byte(packet.server.AccessKey)
-	options := packet.encodeOptions()
-	header := packet.encodeHeader()
 
-	accessKeySum := sum[byte, uint32](accessKeyBytes)
-	accessKeySumBytes := make([]byte, 4)
-	binary.LittleEndian.PutUint32(accessKeySumBytes, accessKeySum)
+	buffer := getPacketBuffer()
+	defer putPacketBuffer(buffer)
+
+	*buffer = packet.appendHeader(*buffer)
+	headerLength := len(*buffer)
+	*buffer = packet.appendOptions(*buffer)
+
+	header := (*buffer)[:headerLength]
+	options := (*buffer)[headerLength:]
+
+	var accessKeySumBytes [4]byte
+	binary.LittleEndian.PutUint32(accessKeySumBytes[:], sum[byte, uint32](accessKeyBytes))
 
-	key := md5.Sum(accessKeyBytes)
-	mac := hmac.New(md5.New, key[:])
+	mac := getSignatureMAC(md5.Sum(accessKeyBytes))
+	defer signatureMACPool.Put(mac)
 
 	if packet.packetType == constants.ConnectPacket && packet.server.PRUDPV1Settings.LegacyConnectionSignature {
 		connectionSignature = make([]byte, 0)
@@ -408,7 +409,7 @@ func defaultPRUDPv1CalculateSignature(packet *PRUDPPacketV1, sessionKey, connect
 
 	mac.Write(header[4:])
 	mac.Write(sessionKey)
-	mac.Write(accessKeySumBytes)
+	mac.Write(accessKeySumBytes[:])
 	mac.Write(connectionSignature)
 	mac.Write(options)
 	mac.Write(packet.payload)
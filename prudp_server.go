@@ -2,13 +2,17 @@ package nex
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
+	"errors"
 	"expvar"
 	"fmt"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/PretendoNetwork/nex-go/v2/constants"
@@ -16,52 +20,96 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/net/ipv4"
 )
 
 // EnableBasicUDPHealthCheck enables a basic UDP echo server
 // on the given port, used to check if the server is reachable
 // at all
 func EnableBasicUDPHealthCheck(port int) {
-	udpAddress, err := net.ResolveUDPAddr("udp", fmt.Sprintf(":%d", port))
+	socket, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		panic(err)
 	}
 
-	socket, err := net.ListenUDP("udp", udpAddress)
-	if err != nil {
-		panic(err)
-	}
+	go func() {
+		err := ServeBasicUDPHealthCheck(socket)
+		if err != nil {
+			logger.Error(err.Error())
+		}
+	}()
+}
+
+// ServeBasicUDPHealthCheck runs a basic UDP echo server on the
+// provided socket, used to check if the server is reachable at
+// all. Blocks until the socket is closed, returning any error
+// other than the socket being closed
+func ServeBasicUDPHealthCheck(socket net.PacketConn) error {
+	errs := make(chan error, runtime.NumCPU())
 
 	for i := 0; i < runtime.NumCPU(); i++ {
 		go func() {
 			buffer := make([]byte, 1024)
 
 			for {
-				n, clientAddr, err := socket.ReadFromUDP(buffer)
-				if err == nil {
-					socket.WriteToUDP(buffer[:n], clientAddr)
+				n, clientAddr, err := socket.ReadFrom(buffer)
+				if err != nil {
+					errs <- err
+					return
 				}
+
+				socket.WriteTo(buffer[:n], clientAddr)
 			}
 		}()
 	}
+
+	var err error
+
+	for i := 0; i < runtime.NumCPU(); i++ {
+		if readErr := <-errs; err == nil && !errors.Is(readErr, net.ErrClosed) {
+			err = readErr
+		}
+	}
+
+	return err
 }
 
 // PRUDPServer represents a bare-bones PRUDP server
 type PRUDPServer struct {
-	udpSocket                     *net.UDPConn
+	udpSocket                     net.PacketConn
 	websocketServer               *WebSocketServer
 	Endpoints                     *MutexMap[uint8, *PRUDPEndPoint]
 	SupportedFunctions            uint32
 	AccessKey                     string
 	KerberosTicketVersion         int
 	SessionKeyLength              int
-	FragmentSize                  int
+	FragmentSize                  int // * Max DATA payload size used for every connection when MTU is 0
+	MTU                           int // * When set, the max DATA payload size is derived per connection from this MTU instead of using FragmentSize
 	PRUDPv1ConnectionSignatureKey []byte
 	LibraryVersions               *LibraryVersions
 	ByteStreamSettings            *ByteStreamSettings
 	PRUDPV0Settings               *PRUDPV0Settings
 	PRUDPV1Settings               *PRUDPV1Settings
 	UseVerboseRMC                 bool
+	MaxHalfOpenConnections        int  // * Max number of connections, across all endpoints, which may be in the middle of a handshake. 0 disables the limit
+	MaxHalfOpenConnectionsPerIP   int  // * Max number of connections from a single IP which may be in the middle of a handshake. 0 disables the limit
+	UseSynCookies                 bool // * Answer SYN packets from new clients without storing anything, see PRUDPEndPoint.synCookie
+	halfOpenConnections           *halfOpenConnections
+	WorkerCount                   int  // * Number of workers processing inbound packets. 0 uses one per CPU
+	WorkerQueueSize               int  // * Number of packets each worker can have waiting to be processed
+	BlockOnFullWorkerQueue        bool // * Wait for room when a worker queue is full, instead of dropping the packet. Slows down reading from the sockets
+	BatchSize                     int  // * Max number of datagrams read or written per syscall on UDP sockets. 0 or 1 disables batching
+	ReusePortSockets              int  // * Number of sockets the Listen functions open per address using SO_REUSEPORT, for the kernel to spread clients across. 0 or 1 opens a single socket. Ignored where unsupported, which is everywhere but Linux and DragonFly BSD
+	udpListeners                  []*udpListener
+	udpListenersMutex             sync.Mutex
+	workerPool                    *packetWorkerPool
+	workerPoolOnce                sync.Once
+	timerWheels                   []*timerWheel
+	timerWheelsOnce               sync.Once
+	nextTimerWheel                atomic.Uint32
+	shuttingDown                  atomic.Bool
+	inFlightPackets               atomic.Int64
+	packetsDrained                chan struct{}
 }
 
 // EnableMetrics enables the net/http/pprof server at the specified address.
@@ -76,6 +124,14 @@ func (ps *PRUDPServer) EnableMetrics(addr string) {
 		[]string{"endpoint_id"},
 	)
 
+	endpointRejectedConnections := promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "prudp_endpoint_rejected_connections_total",
+			Help: "Number of connections rejected per PRUDP endpoint because a connection limit was reached",
+		},
+		[]string{"endpoint_id"},
+	)
+
 	totalConnections := promauto.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "prudp_total_connections",
@@ -87,12 +143,19 @@ func (ps *PRUDPServer) EnableMetrics(addr string) {
 		ticker := time.NewTicker(5 * time.Second)
 		defer ticker.Stop()
 
+		// * Counters can only be added to, so only what
+		// * was rejected since the last tick is added
+		reportedRejections := make(map[uint8]uint64)
+
 		for range ticker.C {
 			total := 0
 			ps.Endpoints.Each(func(key uint8, endpoint *PRUDPEndPoint) bool {
 				count := endpoint.Connections.Size()
 				total += count
 				endpointConnections.WithLabelValues(fmt.Sprintf("prudp_endpoint_%d", endpoint.StreamID)).Set(float64(count))
+				rejected := endpoint.RejectedConnections()
+				endpointRejectedConnections.WithLabelValues(fmt.Sprintf("prudp_endpoint_%d", endpoint.StreamID)).Add(float64(rejected - reportedRejections[key]))
+				reportedRejections[key] = rejected
 				return false
 			})
 			totalConnections.Set(float64(total))
@@ -103,13 +166,16 @@ func (ps *PRUDPServer) EnableMetrics(addr string) {
 		result := make(map[string]any)
 
 		endpointCounts := make(map[string]int)
+		endpointRejectedCounts := make(map[string]uint64)
 
 		ps.Endpoints.Each(func(_ uint8, endpoint *PRUDPEndPoint) bool {
 			endpointCounts[fmt.Sprintf("prudp_endpoint_%d", endpoint.StreamID)] = endpoint.Connections.Size()
+			endpointRejectedCounts[fmt.Sprintf("prudp_endpoint_%d", endpoint.StreamID)] = endpoint.RejectedConnections()
 			return false
 		})
 
 		result["prudp_endpoint_connections"] = endpointCounts
+		result["prudp_endpoint_rejected_connections"] = endpointRejectedCounts
 
 		return result
 	}))
@@ -138,93 +204,241 @@ func (ps *PRUDPServer) Listen(port int) {
 	ps.ListenUDP(port)
 }
 
-// ListenUDP starts a PRUDP server on a given port using a UDP server
+// ListenUDP starts a PRUDP server on a given port using a UDP server.
+// Opens ReusePortSockets sockets when set. Panics if the sockets cannot
+// be opened. See ServeUDP to handle errors
 func (ps *PRUDPServer) ListenUDP(port int) {
-	ps.initPRUDPv1ConnectionSignatureKey()
+	ps.ListenUDPAddresses(fmt.Sprintf(":%d", port))
+}
+
+// ListenUDPAddresses starts a PRUDP server listening on every given address, such as "0.0.0.0:60000" or
+// "[::1]:60001", using UDP servers. Used to serve several ports or interfaces from one server, such as
+// one port per region. Opens ReusePortSockets sockets per address when set. Panics if the sockets cannot
+// be opened. See ServeUDPSockets to handle errors
+func (ps *PRUDPServer) ListenUDPAddresses(addresses ...string) {
+	sockets := make([]net.PacketConn, 0, len(addresses))
+
+	for _, address := range addresses {
+		addressSockets, err := listenUDPSockets(address, ps.ReusePortSockets)
+		if err != nil {
+			for _, socket := range sockets {
+				socket.Close()
+			}
+
+			panic(err)
+		}
+
+		sockets = append(sockets, addressSockets...)
+	}
 
-	udpAddress, err := net.ResolveUDPAddr("udp", fmt.Sprintf(":%d", port))
+	err := ps.ServeUDPSockets(sockets...)
 	if err != nil {
 		panic(err)
 	}
+}
 
-	socket, err := net.ListenUDP("udp", udpAddress)
+// ListenUDPDualStack starts a PRUDP server on a given port using separate IPv4 and IPv6 UDP servers.
+// Unlike ListenUDP, this does not rely on the system accepting IPv4 clients on IPv6 sockets.
+// Panics if the sockets cannot be opened. See ServeUDPSockets to handle errors
+func (ps *PRUDPServer) ListenUDPDualStack(port int) {
+	ps.ListenUDPAddresses(fmt.Sprintf("0.0.0.0:%d", port), fmt.Sprintf("[::]:%d", port))
+}
+
+// ServeUDP starts a PRUDP server using the provided UDP socket.
+// Blocks until the socket is closed or fails. Returns nil if the
+// socket was closed by Shutdown
+func (ps *PRUDPServer) ServeUDP(socket net.PacketConn) error {
+	return ps.ServeUDPSockets(socket)
+}
+
+// ServeUDPSockets starts a PRUDP server using all of the provided UDP sockets. Packets are
+// always answered from the socket they were received on. Blocks until every socket is closed
+// or one fails. Returns nil if the sockets were closed by Shutdown, or an error if no sockets are given
+func (ps *PRUDPServer) ServeUDPSockets(sockets ...net.PacketConn) error {
+	if len(sockets) == 0 {
+		return errors.New("No sockets to serve")
+	}
+
+	err := ps.initPRUDPv1ConnectionSignatureKey()
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	ps.udpSocket = socket
+	// * The readers are split between the sockets
+	readers := max(runtime.NumCPU()/len(sockets), 1)
+	errs := make(chan error, readers*len(sockets))
+	listeners := make([]*udpListener, 0, len(sockets))
 
-	quit := make(chan struct{})
+	for _, socket := range sockets {
+		listener := newUDPListener(socket, ps.BatchSize)
+		listeners = append(listeners, listener)
 
-	for i := 0; i < runtime.NumCPU(); i++ {
-		go ps.listenDatagram(quit)
+		ps.udpListenersMutex.Lock()
+		ps.udpListeners = append(ps.udpListeners, listener)
+		ps.udpListenersMutex.Unlock()
+
+		for i := 0; i < readers; i++ {
+			go func() {
+				errs <- ps.listenDatagram(listener)
+			}()
+		}
 	}
 
-	<-quit
+	// * Only returns once every reader has stopped
+	for i := 0; i < cap(errs); i++ {
+		if readErr := <-errs; err == nil {
+			err = readErr
+		}
+	}
+
+	// * Nothing can be received anymore, so the batch writers aren't needed either
+	for _, listener := range listeners {
+		if listener.batchConn != nil {
+			listener.batchConn.close()
+		}
+	}
+
+	return err
 }
 
-func (ps *PRUDPServer) listenDatagram(quit chan struct{}) {
-	var err error
-	buffer := make([]byte, 64000)
+func (ps *PRUDPServer) listenDatagram(listener *udpListener) error {
+	if listener.batchConn != nil {
+		return ps.listenDatagramBatch(listener)
+	}
 
-	for err == nil {
-		var read int
-		var addr *net.UDPAddr
+	// * Packets copy everything they keep while being decoded,
+	// * so the same buffer can be used for every datagram
+	buffer := make([]byte, maxDatagramSize)
 
-		read, addr, err = ps.udpSocket.ReadFromUDP(buffer)
-		if err == nil {
-			packetData := make([]byte, read)
-			copy(packetData, buffer[:read])
+	for {
+		read, addr, err := listener.socket.ReadFrom(buffer)
+		if err != nil {
+			// * The socket being closed during a shutdown is expected
+			if ps.shuttingDown.Load() {
+				return nil
+			}
+
+			return err
+		}
+
+		socket := NewSocketConnection(ps, addr, nil)
+		socket.udpListener = listener
 
-			err = ps.handleSocketMessage(packetData, addr, nil)
+		err = ps.handleSocketMessage(buffer[:read], socket)
+		if err != nil {
+			return err
 		}
 	}
+}
+
+// listenDatagramBatch is listenDatagram for sockets which read up to BatchSize datagrams at once
+func (ps *PRUDPServer) listenDatagramBatch(listener *udpListener) error {
+	messages := make([]ipv4.Message, listener.batchConn.batchSize)
+
+	for i := range messages {
+		messages[i].Buffers = [][]byte{make([]byte, maxDatagramSize)}
+	}
 
-	quit <- struct{}{}
+	for {
+		read, err := listener.batchConn.read(messages)
+		if err != nil {
+			if ps.shuttingDown.Load() {
+				return nil
+			}
 
-	panic(err)
+			return err
+		}
+
+		for _, message := range messages[:read] {
+			socket := NewSocketConnection(ps, message.Addr, nil)
+			socket.udpListener = listener
+
+			err = ps.handleSocketMessage(message.Buffers[0][:message.N], socket)
+			if err != nil {
+				return err
+			}
+		}
+	}
 }
 
-// ListenWebSocket starts a PRUDP server on a given port using a WebSocket server
+// ListenWebSocket starts a PRUDP server on a given port using a WebSocket server.
+// Panics if the listener cannot be opened. See ServeWebSocket to handle errors
 func (ps *PRUDPServer) ListenWebSocket(port int) {
-	ps.initPRUDPv1ConnectionSignatureKey()
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		panic(err)
+	}
+
+	err = ps.ServeWebSocket(listener)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ServeWebSocket starts a PRUDP server using a WebSocket server on the provided listener.
+// Blocks until the listener is closed or fails. Returns nil if the server was stopped by Shutdown
+func (ps *PRUDPServer) ServeWebSocket(listener net.Listener) error {
+	err := ps.initPRUDPv1ConnectionSignatureKey()
+	if err != nil {
+		return err
+	}
 
 	ps.websocketServer = &WebSocketServer{
 		prudpServer: ps,
 	}
 
-	ps.websocketServer.listen(port)
+	return ps.websocketServer.serve(listener)
 }
 
-// ListenWebSocketSecure starts a PRUDP server on a given port using a secure (TLS) WebSocket server
+// ListenWebSocketSecure starts a PRUDP server on a given port using a secure (TLS) WebSocket server.
+// Panics if the listener cannot be opened. See ServeWebSocketSecure to handle errors
 func (ps *PRUDPServer) ListenWebSocketSecure(port int, certFile, keyFile string) {
-	ps.initPRUDPv1ConnectionSignatureKey()
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		panic(err)
+	}
+
+	err = ps.ServeWebSocketSecure(listener, certFile, keyFile)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ServeWebSocketSecure starts a PRUDP server using a secure (TLS) WebSocket server on the provided listener.
+// Blocks until the listener is closed or fails. Returns nil if the server was stopped by Shutdown
+func (ps *PRUDPServer) ServeWebSocketSecure(listener net.Listener, certFile, keyFile string) error {
+	err := ps.initPRUDPv1ConnectionSignatureKey()
+	if err != nil {
+		return err
+	}
 
 	ps.websocketServer = &WebSocketServer{
 		prudpServer: ps,
 	}
 
-	ps.websocketServer.listenSecure(port, certFile, keyFile)
+	return ps.websocketServer.serveSecure(listener, certFile, keyFile)
 }
 
-func (ps *PRUDPServer) initPRUDPv1ConnectionSignatureKey() {
+func (ps *PRUDPServer) initPRUDPv1ConnectionSignatureKey() error {
 	// * Ensure the server has a key for PRUDPv1 connection signatures
 	if len(ps.PRUDPv1ConnectionSignatureKey) != 16 {
 		ps.PRUDPv1ConnectionSignatureKey = make([]byte, 16)
 		_, err := rand.Read(ps.PRUDPv1ConnectionSignatureKey)
 		if err != nil {
-			panic(err)
+			return fmt.Errorf("Failed to generate PRUDPv1 connection signature key. %s", err.Error())
 		}
 	}
+
+	return nil
 }
 
-func (ps *PRUDPServer) handleSocketMessage(packetData []byte, address net.Addr, webSocketConnection *gws.Conn) error {
+func (ps *PRUDPServer) handleSocketMessage(packetData []byte, socket *SocketConnection) error {
 	// * Check that the message is long enough for initial parsing
 	if len(packetData) < 2 {
 		return nil
 	}
 
-	readStream := NewByteStreamIn(packetData, ps.LibraryVersions, ps.ByteStreamSettings)
+	readStream := getByteStreamIn(packetData, ps.LibraryVersions, ps.ByteStreamSettings)
 
 	var packets []PRUDPPacketInterface
 
@@ -240,37 +454,101 @@ func (ps *PRUDPServer) handleSocketMessage(packetData []byte, address net.Addr,
 		packets, _ = NewPRUDPPacketsV0(ps, nil, readStream)
 	}
 
+	putByteStreamIn(readStream)
+
+	workerPool := ps.packetWorkerPool()
+
 	for _, packet := range packets {
-		go ps.processPacket(packet, address, webSocketConnection)
+		ps.inFlightPackets.Add(1)
+
+		if !workerPool.queue(packet, socket) {
+			ps.packetProcessed()
+		}
 	}
 
 	return nil
 }
 
-func (ps *PRUDPServer) processPacket(packet PRUDPPacketInterface, address net.Addr, webSocketConnection *gws.Conn) {
+// packetWorkerPool returns the worker pool processing inbound packets, starting it on first use
+func (ps *PRUDPServer) packetWorkerPool() *packetWorkerPool {
+	ps.workerPoolOnce.Do(func() {
+		workers := ps.WorkerCount
+		if workers <= 0 {
+			workers = runtime.NumCPU()
+		}
+
+		ps.workerPool = newPacketWorkerPool(ps, workers, max(ps.WorkerQueueSize, 1))
+	})
+
+	return ps.workerPool
+}
+
+// timerWheel returns the wheel running the timers of a new connection.
+// Connections are spread across one wheel per CPU
+func (ps *PRUDPServer) timerWheel() *timerWheel {
+	ps.timerWheelsOnce.Do(func() {
+		ps.timerWheels = make([]*timerWheel, runtime.NumCPU())
+
+		for i := range ps.timerWheels {
+			ps.timerWheels[i] = newTimerWheel()
+		}
+	})
+
+	return ps.timerWheels[ps.nextTimerWheel.Add(1)%uint32(len(ps.timerWheels))]
+}
+
+// DroppedPackets returns the number of inbound packets dropped because the queue of their worker was full
+func (ps *PRUDPServer) DroppedPackets() uint64 {
+	return ps.packetWorkerPool().dropped.Load()
+}
+
+// StalledPackets returns the number of inbound packets which had to wait for room in the queue of their worker.
+// Only counted when BlockOnFullWorkerQueue is set
+func (ps *PRUDPServer) StalledPackets() uint64 {
+	return ps.packetWorkerPool().stalled.Load()
+}
+
+// packetProcessed marks an in-flight packet as processed, notifying Shutdown once none remain
+func (ps *PRUDPServer) packetProcessed() {
+	if ps.inFlightPackets.Add(-1) == 0 {
+		select {
+		case ps.packetsDrained <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (ps *PRUDPServer) processPacket(packet PRUDPPacketInterface, socket *SocketConnection) {
+	// * Once shutting down, no new connections may be opened.
+	// * Existing connections are still processed so that any
+	// * in-flight requests can be acknowledged and answered
+	if ps.shuttingDown.Load() && (packet.Type() == constants.SynPacket || packet.Type() == constants.ConnectPacket) {
+		return
+	}
+
 	if !ps.Endpoints.Has(packet.DestinationVirtualPortStreamID()) {
-		logger.Warningf("Client %s trying to connect to unbound PRUDPEndPoint %d", address.String(), packet.DestinationVirtualPortStreamID())
+		logger.Warningf("Client %s trying to connect to unbound PRUDPEndPoint %d", socket.Address.String(), packet.DestinationVirtualPortStreamID())
 		return
 	}
 
 	endpoint, ok := ps.Endpoints.Get(packet.DestinationVirtualPortStreamID())
 	if !ok {
-		logger.Warningf("Client %s trying to connect to unbound PRUDPEndPoint %d", address.String(), packet.DestinationVirtualPortStreamID())
+		logger.Warningf("Client %s trying to connect to unbound PRUDPEndPoint %d", socket.Address.String(), packet.DestinationVirtualPortStreamID())
 		return
 	}
 
 	if packet.DestinationVirtualPortStreamType() != packet.SourceVirtualPortStreamType() {
-		logger.Warningf("Client %s trying to use non matching destination and source stream types %d and %d", address.String(), packet.DestinationVirtualPortStreamType(), packet.SourceVirtualPortStreamType())
+		logger.Warningf("Client %s trying to use non matching destination and source stream types %d and %d", socket.Address.String(), packet.DestinationVirtualPortStreamType(), packet.SourceVirtualPortStreamType())
 		return
 	}
 
 	if packet.DestinationVirtualPortStreamType() > constants.StreamTypeRelay {
-		logger.Warningf("Client %s trying to use invalid to destination stream type %d", address.String(), packet.DestinationVirtualPortStreamType())
+		logger.Warningf("Client %s trying to use invalid to destination stream type %d", socket.Address.String(), packet.DestinationVirtualPortStreamType())
 		return
 	}
 
 	if packet.SourceVirtualPortStreamType() > constants.StreamTypeRelay {
-		logger.Warningf("Client %s trying to use invalid to source stream type %d", address.String(), packet.DestinationVirtualPortStreamType())
+		logger.Warningf("Client %s trying to use invalid to source stream type %d", socket.Address.String(), packet.DestinationVirtualPortStreamType())
 		return
 	}
 
@@ -288,44 +566,175 @@ func (ps *PRUDPServer) processPacket(packet PRUDPPacketInterface, address net.Ad
 	}
 
 	if invalidSourcePort {
-		logger.Warningf("Client %s trying to use invalid to source port number %d. Port number too large", address.String(), sourcePortNumber)
+		logger.Warningf("Client %s trying to use invalid to source port number %d. Port number too large", socket.Address.String(), sourcePortNumber)
 		return
 	}
 
-	socket := NewSocketConnection(ps, address, webSocketConnection)
 	endpoint.processPacket(packet, socket)
 }
 
-// Send sends the packet to the packets sender
+// Shutdown gracefully stops the server.
+//
+// New SYN and CONNECT packets are ignored, and packets which are already being processed are given until the
+// context is done to finish. Every connection on every bound PRUDPEndPoint is then sent a DISCONNECT packet, which
+// is resent for a short time until the client acknowledges it. The connections are then cleaned up, stopping all of
+// their retransmission and heartbeat timers, and the underlying sockets are closed.
+// Once this happens the blocking Listen functions return rather than panicking.
+//
+// Returns the context error if in-flight packets did not finish in time. The server is still stopped in this case
+func (ps *PRUDPServer) Shutdown(ctx context.Context) error {
+	if !ps.shuttingDown.CompareAndSwap(false, true) {
+		return errors.New("PRUDPServer is already shutting down")
+	}
+
+	var err error
+
+	for err == nil && ps.inFlightPackets.Load() > 0 {
+		select {
+		case <-ps.packetsDrained:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+	}
+
+	// * Every endpoint waits for its clients to acknowledge
+	// * the DISCONNECT at the same time
+	var disconnected sync.WaitGroup
+
+	ps.Endpoints.Each(func(_ uint8, endpoint *PRUDPEndPoint) bool {
+		disconnected.Add(1)
+
+		go func() {
+			defer disconnected.Done()
+			endpoint.disconnectAll(ctx)
+		}()
+
+		return false
+	})
+
+	disconnected.Wait()
+
+	if ps.udpSocket != nil {
+		if closeErr := ps.udpSocket.Close(); closeErr != nil {
+			logger.Error(closeErr.Error())
+		}
+	}
+
+	ps.udpListenersMutex.Lock()
+
+	for _, listener := range ps.udpListeners {
+		if closeErr := listener.close(); closeErr != nil {
+			logger.Error(closeErr.Error())
+		}
+	}
+
+	ps.udpListenersMutex.Unlock()
+
+	if ps.websocketServer != nil {
+		ps.websocketServer.close()
+	}
+
+	ps.packetWorkerPool().close()
+
+	return err
+}
+
+// Send sends the packet to the packets sender.
+// The connection lock is held while the packet is queued, so this must not be called with it already held
 func (ps *PRUDPServer) Send(packet PacketInterface) {
 	if packet, ok := packet.(PRUDPPacketInterface); ok {
-		data := packet.Payload()
-		fragments := int(len(data) / ps.FragmentSize)
-
-		var fragmentID uint8 = 1
-		for i := 0; i <= fragments; i++ {
-			if len(data) < ps.FragmentSize {
-				packet.SetPayload(data)
-				packet.setFragmentID(0)
-			} else {
-				packet.SetPayload(data[:ps.FragmentSize])
-				packet.setFragmentID(fragmentID)
-
-				data = data[ps.FragmentSize:]
-				fragmentID++
-			}
+		// * "data" handlers run outside of the connection lock, so
+		// * sending must not race with processPacket over the
+		// * SlidingWindows, StreamSettings and session key
+		connection := packet.Sender().(*PRUDPConnection)
+
+		connection.Lock()
+		defer connection.Unlock()
 
-			ps.sendPacket(packet)
+		ps.send(packet, nil)
+	}
+}
+
+// SendWithConfirmation sends the packet to the packets sender, like Send, and returns a DeliveryHandle
+// which is resolved once every fragment of the packet has been acknowledged, or once sending has failed.
+// The connection lock is held while the packet is queued, so this must not be called with it already held
+func (ps *PRUDPServer) SendWithConfirmation(packet PRUDPPacketInterface) *DeliveryHandle {
+	delivery := newDeliveryHandle()
+	connection := packet.Sender().(*PRUDPConnection)
+
+	// * Keeps the connection from being removed between
+	// * checking its state and queueing the fragments
+	connection.Lock()
+	defer connection.Unlock()
+
+	if connection.ConnectionState != StateConnected {
+		delivery.fail(ErrDeliveryConnectionClosed)
+		return delivery
+	}
+
+	ps.send(packet, delivery)
+
+	return delivery
+}
+
+// send splits the packet into fragments and queues them to be sent. delivery may be nil.
+// Must be called with the connection lock held
+func (ps *PRUDPServer) send(packet PRUDPPacketInterface, delivery *DeliveryHandle) {
+	connection := packet.Sender().(*PRUDPConnection)
+	fragmentSize := connection.FragmentSize()
+	data := packet.Payload()
+	fragments := int(len(data) / fragmentSize)
+	packets := make([]PRUDPPacketInterface, 0, fragments+1)
+
+	var fragmentID uint8 = 1
+	for i := 0; i <= fragments; i++ {
+		fragment := packet.Copy()
+		fragment.setDelivery(delivery)
+
+		if len(data) < fragmentSize {
+			fragment.SetPayload(data)
+			fragment.setFragmentID(0)
+		} else {
+			fragment.SetPayload(data[:fragmentSize])
+			fragment.setFragmentID(fragmentID)
+
+			data = data[fragmentSize:]
+			fragmentID++
+		}
 
-			// * This delay is here to prevent the server from overloading the client with too many packets.
-			// * The 16ms (1/60th of a second) value is chosen based on testing with the friends server and is a good balance between
-			// * Not being too slow and also not dropping any packets because we've overloaded the client. This may be because it
-			// * roughly matches the framerate that most games target (60fps)
-			if i < fragments {
-				time.Sleep(16 * time.Millisecond)
+		packets = append(packets, fragment)
+	}
+
+	// * Messages are dropped whole, a partial message
+	// * would never be reassembled by the client
+	if packet.HasFlag(constants.PacketFlagReliable) && packet.HasFlag(constants.PacketFlagNeedsAck) {
+		maxQueued := connection.StreamSettings.MaxQueuedPackets
+		queued := connection.pacer.QueueDepth() + connection.SlidingWindow(packet.SubstreamID()).QueueDepth()
+
+		if maxQueued != 0 && uint32(queued+len(packets)) > maxQueued {
+			for _, fragment := range packets {
+				fragment.release()
 			}
+
+			if delivery != nil {
+				delivery.fail(ErrDeliveryWindowOverflow)
+			}
+
+			connection.endpoint.EmitError(NewError(ResultCodes.Transport.PacketBufferFull, fmt.Sprintf("Dropped message to %s, %d packets are already waiting to be sent", connection.Address().String(), queued)))
+
+			return
 		}
 	}
+
+	if delivery != nil {
+		delivery.remaining.Store(int32(len(packets)))
+	}
+
+	// * All fragments are queued at once, so fragments
+	// * from different messages are never interleaved.
+	// * Unreliable fragments rely on this, since they
+	// * are reassembled using consecutive sequence IDs
+	connection.pacer.Queue(packets...)
 }
 
 func (ps *PRUDPServer) sendPacket(packet PRUDPPacketInterface) {
@@ -387,12 +796,34 @@ func (ps *PRUDPServer) sendPacket(packet PRUDPPacketInterface) {
 	packetCopy.incrementSendCount()
 	packetCopy.setSentAt(time.Now())
 
+	// * Reliable packets are sent by their SlidingWindow,
+	// * which may need to hold them until the window has room
 	if packetCopy.HasFlag(constants.PacketFlagReliable) && packetCopy.HasFlag(constants.PacketFlagNeedsAck) {
 		slidingWindow := connection.SlidingWindow(packetCopy.SubstreamID())
-		slidingWindow.TimeoutManager.SchedulePacketTimeout(packetCopy)
+		slidingWindow.Submit(packetCopy)
+		return
 	}
 
-	ps.SendRaw(packetCopy.Sender().(*PRUDPConnection).Socket, packetCopy.Bytes())
+	ps.writePacket(connection.Socket, packetCopy)
+
+	// * Unreliable packets are never acknowledged,
+	// * so being sent is as far as they can be tracked
+	if delivery := packetCopy.getDelivery(); delivery != nil {
+		delivery.delivered()
+	}
+
+	// * Nothing else holds on to the copy once it has been sent
+	packetCopy.release()
+}
+
+// writePacket encodes the packet into a pooled buffer and sends it to the socket
+func (ps *PRUDPServer) writePacket(socket *SocketConnection, packet PRUDPPacketInterface) {
+	buffer := getPacketBuffer()
+	defer putPacketBuffer(buffer)
+
+	*buffer = packet.appendBytes(*buffer)
+
+	ps.SendRaw(socket, *buffer)
 }
 
 // SendRaw will send the given socket the provided packet
@@ -401,10 +832,12 @@ func (ps *PRUDPServer) SendRaw(socket *SocketConnection, data []byte) {
 
 	var err error
 
-	if address, ok := socket.Address.(*net.UDPAddr); ok && ps.udpSocket != nil {
-		_, err = ps.udpSocket.WriteToUDP(data, address)
-	} else if socket.WebSocketConnection != nil {
+	if socket.WebSocketConnection != nil {
 		err = socket.WebSocketConnection.WriteMessage(gws.OpcodeBinary, data)
+	} else if socket.udpListener != nil {
+		err = socket.udpListener.write(data, socket.Address)
+	} else if ps.udpSocket != nil {
+		_, err = ps.udpSocket.WriteTo(data, socket.Address)
 	}
 
 	if err != nil {
@@ -412,9 +845,9 @@ func (ps *PRUDPServer) SendRaw(socket *SocketConnection, data []byte) {
 	}
 }
 
-// SetFragmentSize sets the max size for a packets payload
+// SetFragmentSize sets the max size for a packets payload.
+// Only used when no MTU is set, see SetMTU
 func (ps *PRUDPServer) SetFragmentSize(fragmentSize int) {
-	// TODO - Derive this value from the MTU
 	// * From the wiki:
 	// *
 	// * The fragment size depends on the implementation.
@@ -428,15 +861,30 @@ func (ps *PRUDPServer) SetFragmentSize(fragmentSize int) {
 	ps.FragmentSize = fragmentSize
 }
 
+// SetMTU sets the MTU used to derive the max payload size of each connection.
+// The payload size then depends on the PRUDP version, packet options and compression
+// used by the connection, see PRUDPConnection.FragmentSize. 0 uses the fixed FragmentSize
+func (ps *PRUDPServer) SetMTU(mtu int) {
+	ps.MTU = mtu
+}
+
+// HalfOpenConnections returns the number of connections, across all endpoints, which are in the middle of a handshake
+func (ps *PRUDPServer) HalfOpenConnections() int {
+	return ps.halfOpenConnections.count(nil)
+}
+
 // NewPRUDPServer will return a new PRUDP server
 func NewPRUDPServer() *PRUDPServer {
 	return &PRUDPServer{
-		Endpoints:          NewMutexMap[uint8, *PRUDPEndPoint](),
-		SessionKeyLength:   32,
-		FragmentSize:       1300,
-		LibraryVersions:    NewLibraryVersions(),
-		ByteStreamSettings: NewByteStreamSettings(),
-		PRUDPV0Settings:    NewPRUDPV0Settings(),
-		PRUDPV1Settings:    NewPRUDPV1Settings(),
+		Endpoints:           NewMutexMap[uint8, *PRUDPEndPoint](),
+		SessionKeyLength:    32,
+		FragmentSize:        1300,
+		LibraryVersions:     NewLibraryVersions(),
+		ByteStreamSettings:  NewByteStreamSettings(),
+		PRUDPV0Settings:     NewPRUDPV0Settings(),
+		PRUDPV1Settings:     NewPRUDPV1Settings(),
+		halfOpenConnections: newHalfOpenConnections(),
+		WorkerQueueSize:     1024,
+		packetsDrained:      make(chan struct{}, 1),
 	}
 }
@@ -0,0 +1,188 @@
+package nex
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/PretendoNetwork/nex-go/v2/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPRUDPServerServeUDP(t *testing.T) {
+	server, _ := newTestEchoServer(false)
+
+	socket, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- server.ServeUDP(socket)
+	}()
+
+	client := NewPRUDPClient(1, 1)
+	client.Server.AccessKey = server.AccessKey
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	assert.NoError(t, client.Dial(ctx, socket.LocalAddr().String()))
+	client.Close()
+
+	assert.NoError(t, server.Shutdown(context.Background()))
+
+	// * Stopping the server is not an error
+	assert.NoError(t, <-served)
+}
+
+func TestPRUDPServerServeWebSocket(t *testing.T) {
+	for _, secure := range []bool{false, true} {
+		server, _ := newTestEchoServer(false)
+
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		served := make(chan error, 1)
+		client := &http.Client{}
+		url := "http://" + listener.Addr().String()
+
+		if secure {
+			certFile, keyFile := writeTestCertificate(t)
+
+			go func() {
+				served <- server.ServeWebSocketSecure(listener, certFile, keyFile)
+			}()
+
+			client.Transport = &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			}
+			url = "https://" + listener.Addr().String()
+		} else {
+			go func() {
+				served <- server.ServeWebSocket(listener)
+			}()
+		}
+
+		// * Not a WebSocket upgrade, but shows the server is answering
+		response, err := client.Get(url)
+		if assert.NoError(t, err) {
+			response.Body.Close()
+		}
+
+		assert.NoError(t, server.Shutdown(context.Background()))
+
+		// * Stopping the server is not an error
+		assert.NoError(t, <-served)
+	}
+}
+
+func TestServeBasicUDPHealthCheck(t *testing.T) {
+	socket, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- ServeBasicUDPHealthCheck(socket)
+	}()
+
+	client, err := net.Dial("udp", socket.LocalAddr().String())
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	defer client.Close()
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	client.Write([]byte("ping"))
+
+	buffer := make([]byte, 16)
+	read, err := client.Read(buffer)
+	if assert.NoError(t, err) {
+		assert.Equal(t, []byte("ping"), buffer[:read])
+	}
+
+	// * Closing the socket is how the health check is stopped
+	socket.Close()
+	assert.NoError(t, <-served)
+}
+
+func TestPRUDPServerShutdown(t *testing.T) {
+	network := simulator.NewNetwork(simulator.Settings{}, 16)
+
+	server, endpoint := newTestEchoServer(false)
+
+	serverSocket, _ := network.Listen("127.0.0.1:60000")
+
+	go server.ServeUDP(serverSocket)
+
+	clients := make([]*PRUDPClient, 4)
+
+	for i := range clients {
+		clientSocket, _ := network.Listen("127.0.0.1:0")
+
+		clients[i] = NewPRUDPClient(1, 1)
+		clients[i].Server.AccessKey = server.AccessKey
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if !assert.NoError(t, clients[i].ConnectUDP(ctx, clientSocket, serverSocket.LocalAddr())) {
+			return
+		}
+	}
+
+	// * A request which is still being handled when the shutdown starts
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+
+	endpoint.OnData(func(packet PacketInterface) {
+		if packet.RMCMessage().MethodID == 2 {
+			close(started)
+			<-unblock
+		}
+	})
+
+	go clients[0].Call(context.Background(), 0x64, 2, nil)
+	<-started
+
+	// * Some DISCONNECT packets are lost, and must be resent
+	network.SetSettings(simulator.Settings{PacketLoss: 0.3})
+
+	stopped := make(chan error, 1)
+
+	go func() {
+		stopped <- server.Shutdown(context.Background())
+	}()
+
+	select {
+	case <-stopped:
+		t.Fatal("Shutdown did not wait for the request being handled")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(unblock)
+
+	assert.NoError(t, <-stopped)
+
+	for i, client := range clients {
+		select {
+		case <-client.Done():
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Client %d was not disconnected", i)
+		}
+	}
+
+	assert.Zero(t, endpoint.Connections.Size())
+	assert.NotZero(t, network.Stats().Dropped)
+}
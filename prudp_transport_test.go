@@ -0,0 +1,1067 @@
+package nex
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PretendoNetwork/nex-go/v2/constants"
+	"github.com/PretendoNetwork/nex-go/v2/simulator"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRetransmissionTimeout keeps retransmissions quick, so lost packets don't slow the tests down
+func testRetransmissionTimeout(_ float64, sendCount uint32) time.Duration {
+	return time.Duration(sendCount) * 20 * time.Millisecond
+}
+
+// newSimulatedConnection connects a client to an echo server over a simulated network
+func newSimulatedConnection(t *testing.T, network *simulator.Network, prudpVersion int) (*PRUDPServer, *PRUDPEndPoint, *PRUDPClient) {
+	server, endpoint := newTestEchoServer(false)
+
+	endpoint.CalcRetransmissionTimeoutCallback = testRetransmissionTimeout
+
+	serverSocket, err := network.Listen("127.0.0.1:60000")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientSocket, err := network.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go server.ServeUDP(serverSocket)
+
+	client := NewPRUDPClient(prudpVersion, 1)
+	client.Server.AccessKey = server.AccessKey
+	client.Endpoint.CalcRetransmissionTimeoutCallback = testRetransmissionTimeout
+	client.Endpoint.DefaultStreamSettings.SynInitialRTT = 50
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := client.ConnectUDP(ctx, clientSocket, serverSocket.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		client.Close()
+		server.Shutdown(context.Background())
+	})
+
+	return server, endpoint, client
+}
+
+func TestPRUDPTransportLossyNetwork(t *testing.T) {
+	for _, prudpVersion := range []int{0, 1} {
+		network := simulator.NewNetwork(simulator.Settings{
+			PacketLoss:   0.1,
+			Duplication:  0.05,
+			Reordering:   0.1,
+			ReorderDelay: 10 * time.Millisecond,
+			Latency:      2 * time.Millisecond,
+			Jitter:       2 * time.Millisecond,
+		}, 1)
+
+		_, _, client := newSimulatedConnection(t, network, prudpVersion)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		for i := 0; i < 10; i++ {
+			// * Large enough to be split into several fragments
+			parameters := bytes.Repeat([]byte{byte(i)}, 5000+i)
+
+			response, err := client.Call(ctx, 0x64, 1, parameters)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, parameters, response.Parameters)
+		}
+
+		stats := network.Stats()
+		assert.NotZero(t, stats.Dropped)
+		assert.NotZero(t, stats.Duplicated)
+		assert.NotZero(t, stats.Reordered)
+	}
+}
+
+func TestPRUDPTransportConcurrentCalls(t *testing.T) {
+	network := simulator.NewNetwork(simulator.Settings{
+		PacketLoss:   0.05,
+		Reordering:   0.2,
+		ReorderDelay: 5 * time.Millisecond,
+		Latency:      time.Millisecond,
+	}, 2)
+
+	_, _, client := newSimulatedConnection(t, network, 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	errs := make(chan error, 20)
+
+	for i := 0; i < cap(errs); i++ {
+		go func(i int) {
+			parameters := bytes.Repeat([]byte{byte(i)}, 100*i)
+
+			response, err := client.Call(ctx, 0x64, 1, parameters)
+			if err == nil && !bytes.Equal(parameters, response.Parameters) {
+				err = assert.AnError
+			}
+
+			errs <- err
+		}(i)
+	}
+
+	for i := 0; i < cap(errs); i++ {
+		assert.NoError(t, <-errs)
+	}
+}
+
+func TestPRUDPTransportWindowSize(t *testing.T) {
+	network := simulator.NewNetwork(simulator.Settings{}, 3)
+
+	_, _, client := newSimulatedConnection(t, network, 1)
+	slidingWindow := client.Connection().SlidingWindow(0)
+	windowSize := int(slidingWindow.streamSettings.WindowSize)
+
+	// * Nothing gets acknowledged while the network is down,
+	// * so only the first few fragments can be sent
+	network.SetSettings(simulator.Settings{PacketLoss: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	parameters := bytes.Repeat([]byte{0xAA}, client.Server.FragmentSize*(windowSize+4))
+	errs := make(chan error, 1)
+
+	go func() {
+		response, err := client.Call(ctx, 0x64, 1, parameters)
+		if err == nil && !bytes.Equal(parameters, response.Parameters) {
+			err = assert.AnError
+		}
+
+		errs <- err
+	}()
+
+	// * The payload is an exact multiple of the fragment size,
+	// * so it also ends with an empty final fragment
+	assert.Eventually(t, func() bool {
+		return slidingWindow.QueueDepth() == 5
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, windowSize, slidingWindow.InFlight())
+
+	network.SetSettings(simulator.Settings{})
+
+	assert.NoError(t, <-errs)
+	assert.Zero(t, slidingWindow.QueueDepth())
+}
+
+func TestPRUDPTransportPacing(t *testing.T) {
+	network := simulator.NewNetwork(simulator.Settings{}, 4)
+
+	_, _, client := newSimulatedConnection(t, network, 1)
+	connection := client.Connection()
+	connection.StreamSettings.PacingRate = 100
+	connection.StreamSettings.PacingBurst = 1
+
+	request := NewRMCRequest(client.Endpoint)
+	request.ProtocolID = 0x64
+	request.MethodID = 1
+	request.CallID = 1
+	request.Parameters = bytes.Repeat([]byte{0xAA}, client.Server.FragmentSize*10)
+
+	packet := client.newPacket(constants.DataPacket)
+	packet.AddFlag(constants.PacketFlagReliable)
+	packet.AddFlag(constants.PacketFlagNeedsAck)
+	packet.SetPayload(request.Bytes())
+
+	start := time.Now()
+
+	client.Server.Send(packet)
+
+	// * Send must not wait for the paced fragments
+	assert.Less(t, time.Since(start), 10*time.Millisecond)
+	assert.NotZero(t, connection.pacer.QueueDepth())
+
+	assert.Eventually(t, func() bool {
+		return connection.pacer.QueueDepth() == 0
+	}, 5*time.Second, time.Millisecond)
+
+	// * 11 packets, the first is sent right away and the rest every 10ms
+	assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+}
+
+func TestPRUDPTransportAggregateAcknowledgements(t *testing.T) {
+	for _, test := range []struct {
+		name         string
+		prudpVersion int
+		minorVersion uint32
+	}{
+		{"PRUDPv0", 0, 0},
+		{"PRUDPv1 old format", 1, 0},
+		{"PRUDPv1 new format", 1, 2},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			network := simulator.NewNetwork(simulator.Settings{
+				PacketLoss:   0.05,
+				Reordering:   0.2,
+				ReorderDelay: 5 * time.Millisecond,
+			}, 5)
+
+			server, endpoint := newTestEchoServer(false)
+			endpoint.CalcRetransmissionTimeoutCallback = testRetransmissionTimeout
+			endpoint.DefaultStreamSettings.AggregateAckDelay = 5
+
+			serverSocket, _ := network.Listen("127.0.0.1:60000")
+			clientSocket, _ := network.Listen("127.0.0.1:0")
+
+			go server.ServeUDP(serverSocket)
+			defer server.Shutdown(context.Background())
+
+			client := NewPRUDPClient(test.prudpVersion, 1)
+			client.MinorVersion = test.minorVersion
+			client.Server.AccessKey = server.AccessKey
+			client.Endpoint.CalcRetransmissionTimeoutCallback = testRetransmissionTimeout
+			client.Endpoint.DefaultStreamSettings.AggregateAckDelay = 5
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			if !assert.NoError(t, client.ConnectUDP(ctx, clientSocket, serverSocket.LocalAddr())) {
+				return
+			}
+
+			defer client.Close()
+
+			assert.Equal(t, test.minorVersion, client.Connection().MinorVersion)
+
+			for i := 0; i < 5; i++ {
+				parameters := bytes.Repeat([]byte{byte(i)}, 4000)
+
+				response, err := client.Call(ctx, 0x64, 1, parameters)
+				if !assert.NoError(t, err) {
+					return
+				}
+
+				assert.Equal(t, parameters, response.Parameters)
+			}
+
+			// * Everything the client sent must have been acknowledged
+			assert.Eventually(t, func() bool {
+				return client.Connection().SlidingWindow(0).InFlight() == 0
+			}, 5*time.Second, 10*time.Millisecond)
+		})
+	}
+}
+
+func TestPRUDPTransportUnreliableFragments(t *testing.T) {
+	for _, prudpVersion := range []int{0, 1} {
+		network := simulator.NewNetwork(simulator.Settings{
+			Reordering:   0.3,
+			ReorderDelay: 5 * time.Millisecond,
+		}, 6)
+
+		_, endpoint, client := newSimulatedConnection(t, network, prudpVersion)
+
+		received := make(chan []byte, 10)
+
+		endpoint.OnData(func(packet PacketInterface) {
+			if !packet.(PRUDPPacketInterface).HasFlag(constants.PacketFlagReliable) {
+				received <- packet.RMCMessage().Parameters
+			}
+		})
+
+		for i := 0; i < 3; i++ {
+			request := NewRMCRequest(client.Endpoint)
+			request.ProtocolID = 0x64
+			request.MethodID = 1
+			request.CallID = uint32(i)
+			request.Parameters = bytes.Repeat([]byte{byte(i)}, 3000+i)
+
+			packet := client.newPacket(constants.DataPacket)
+			packet.SetPayload(request.Bytes())
+
+			client.Server.Send(packet)
+
+			select {
+			case parameters := <-received:
+				assert.Equal(t, request.Parameters, parameters)
+			case <-time.After(5 * time.Second):
+				t.Fatal("Fragmented unreliable message was not received")
+			}
+		}
+
+		// * Too short to be an RMC message, but still handled rather than held for reassembly
+		packet := client.newPacket(constants.DataPacket)
+		packet.SetPayload([]byte{1, 2, 3})
+
+		client.Server.Send(packet)
+
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Short unreliable packet was not received")
+		}
+	}
+}
+
+func TestPRUDPTransportSignatureVerification(t *testing.T) {
+	for _, prudpVersion := range []int{0, 1} {
+		network := simulator.NewNetwork(simulator.Settings{}, 7)
+
+		_, endpoint, client := newSimulatedConnection(t, network, prudpVersion)
+
+		errs := make(chan *Error, 10)
+		endpoint.OnError(func(err *Error) {
+			errs <- err
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		_, err := client.Call(ctx, 0x64, 1, []byte{1, 2, 3})
+		assert.NoError(t, err)
+		assert.Zero(t, endpoint.InvalidSignatures())
+
+		// * A packet forged by someone without the session state
+		connection := client.Connection()
+		forged := client.newPacket(constants.DataPacket)
+		forged.SetSessionID(connection.ServerSessionID)
+		forged.SetSequenceID(100)
+		forged.SetPayload([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+		forged.SetSignature(bytes.Repeat([]byte{0xAA}, len(connection.ServerConnectionSignature)))
+
+		client.Server.SendRaw(connection.Socket, forged.Bytes())
+
+		select {
+		case err := <-errs:
+			assert.Equal(t, ResultCodes.Transport.IncorrectRemoteAuthentication|uint32(errorMask), err.ResultCode)
+		case <-time.After(5 * time.Second):
+			t.Fatal("Forged packet was not reported")
+		}
+
+		assert.Equal(t, uint64(1), endpoint.InvalidSignatures())
+
+		if prudpVersion == 0 {
+			corrupted := forged.Bytes()
+			corrupted[len(corrupted)-1]++
+
+			client.Server.SendRaw(connection.Socket, corrupted)
+
+			assert.Eventually(t, func() bool {
+				return endpoint.InvalidChecksums() == 1
+			}, 5*time.Second, 10*time.Millisecond)
+		}
+	}
+}
+
+func TestPRUDPTransportSessionValidation(t *testing.T) {
+	network := simulator.NewNetwork(simulator.Settings{}, 8)
+
+	_, endpoint, client := newSimulatedConnection(t, network, 1)
+	connection := client.Connection()
+
+	// * A DISCONNECT which is correctly signed, but uses the wrong session ID
+	disconnect := client.newPacket(constants.DisconnectPacket)
+	disconnect.SetSessionID(connection.ServerSessionID + 1)
+	disconnect.SetSignature(disconnect.CalculateSignature(connection.SessionKey, connection.ServerConnectionSignature))
+
+	client.Server.SendRaw(connection.Socket, disconnect.Bytes())
+
+	assert.Eventually(t, func() bool {
+		return endpoint.InvalidSessions() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, 1, endpoint.Connections.Size())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := client.Call(ctx, 0x64, 1, []byte{1, 2, 3})
+	assert.NoError(t, err)
+
+	var serverConnection *PRUDPConnection
+	endpoint.Connections.Each(func(_ string, connection *PRUDPConnection) bool {
+		serverConnection = connection
+		return false
+	})
+
+	endpoint.LenientSessionValidation = true
+
+	client.Server.SendRaw(connection.Socket, disconnect.Bytes())
+
+	assert.Eventually(t, func() bool {
+		serverConnection.Lock()
+		defer serverConnection.Unlock()
+
+		return serverConnection.ConnectionState == StateNotConnected
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, uint64(1), endpoint.InvalidSessions())
+}
+
+// newTestSynPacket returns a PRUDPv1 SYN packet for the test echo server
+func newTestSynPacket() []byte {
+	client := NewPRUDPClient(1, 1)
+
+	syn := client.newPacket(constants.SynPacket)
+	syn.AddFlag(constants.PacketFlagNeedsAck)
+	syn.SetConnectionSignature(make([]byte, 16))
+	syn.SetSignature(syn.CalculateSignature([]byte{}, []byte{}))
+
+	return syn.Bytes()
+}
+
+func TestPRUDPTransportHalfOpenConnections(t *testing.T) {
+	network := simulator.NewNetwork(simulator.Settings{}, 9)
+
+	server, endpoint := newTestEchoServer(false)
+	server.MaxHalfOpenConnectionsPerIP = 2
+	endpoint.DefaultStreamSettings.HandshakeTimeout = 200
+
+	serverSocket, _ := network.Listen("127.0.0.1:60000")
+
+	go server.ServeUDP(serverSocket)
+	defer server.Shutdown(context.Background())
+
+	for i := 0; i < 3; i++ {
+		socket, _ := network.Listen("127.0.0.1:0")
+		socket.WriteTo(newTestSynPacket(), serverSocket.LocalAddr())
+	}
+
+	// * The third SYN is over the per IP limit
+	assert.Eventually(t, func() bool {
+		return server.HalfOpenConnections() == 2
+	}, 5*time.Second, time.Millisecond)
+
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 2, endpoint.Connections.Size())
+
+	// * Neither client ever sends a CONNECT
+	assert.Eventually(t, func() bool {
+		return endpoint.Connections.Size() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Zero(t, server.HalfOpenConnections())
+	assert.Zero(t, endpoint.HalfOpenConnections())
+}
+
+func TestPRUDPTransportSynCookies(t *testing.T) {
+	network := simulator.NewNetwork(simulator.Settings{}, 10)
+
+	server, endpoint := newTestEchoServer(false)
+	server.UseSynCookies = true
+
+	serverSocket, _ := network.Listen("127.0.0.1:60000")
+
+	go server.ServeUDP(serverSocket)
+	defer server.Shutdown(context.Background())
+
+	// * A SYN is answered without anything being stored
+	flooder, _ := network.Listen("127.0.0.1:0")
+	flooder.WriteTo(newTestSynPacket(), serverSocket.LocalAddr())
+
+	flooder.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err := flooder.ReadFrom(make([]byte, 1024))
+	assert.NoError(t, err)
+
+	assert.Zero(t, endpoint.Connections.Size())
+	assert.Zero(t, server.HalfOpenConnections())
+
+	for _, prudpVersion := range []int{0, 1} {
+		clientSocket, _ := network.Listen("127.0.0.1:0")
+
+		client := NewPRUDPClient(prudpVersion, 1)
+		client.Server.AccessKey = server.AccessKey
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if !assert.NoError(t, client.ConnectUDP(ctx, clientSocket, serverSocket.LocalAddr())) {
+			return
+		}
+
+		defer client.Close()
+
+		response, err := client.Call(ctx, 0x64, 1, []byte{1, 2, 3})
+		if assert.NoError(t, err) {
+			assert.Equal(t, []byte{1, 2, 3}, response.Parameters)
+		}
+	}
+
+	assert.Equal(t, 2, endpoint.Connections.Size())
+	assert.Zero(t, server.HalfOpenConnections())
+}
+
+func TestPRUDPTransportConnectionLimits(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		secure bool
+	}{
+		{"MaxConnections", false},
+		{"MaxConnectionsPerPID", true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			network := simulator.NewNetwork(simulator.Settings{}, 11)
+
+			server, endpoint := newTestEchoServer(test.secure)
+
+			if test.secure {
+				endpoint.MaxConnectionsPerPID = 1
+			} else {
+				endpoint.MaxConnections = 1
+			}
+
+			rejected := make(chan *Error, 1)
+			endpoint.OnConnectionRejected(func(connection *PRUDPConnection, err *Error) {
+				rejected <- err
+			})
+
+			serverSocket, _ := network.Listen("127.0.0.1:60000")
+
+			go server.ServeUDP(serverSocket)
+			defer server.Shutdown(context.Background())
+
+			connect := func() error {
+				clientSocket, _ := network.Listen("127.0.0.1:0")
+
+				client := NewPRUDPClient(1, 1)
+				client.Server.AccessKey = server.AccessKey
+				t.Cleanup(func() { client.Close() })
+
+				if test.secure {
+					client.SetKerberosTicket(newTestKerberosTicket(server), testUserAccount.PID, 1)
+				}
+
+				// * Rejected clients are never answered, so they only fail once this expires
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+
+				return client.ConnectUDP(ctx, clientSocket, serverSocket.LocalAddr())
+			}
+
+			assert.NoError(t, connect())
+			assert.Error(t, connect())
+
+			select {
+			case err := <-rejected:
+				assert.Equal(t, ResultCodes.RendezVous.MaxConnectionsReached|uint32(errorMask), err.ResultCode)
+			case <-time.After(5 * time.Second):
+				t.Fatal("Connection was not rejected")
+			}
+
+			assert.NotZero(t, endpoint.RejectedConnections())
+			assert.Equal(t, 1, endpoint.Connections.Size())
+		})
+	}
+}
+
+func TestPRUDPTransportDuplicateLogin(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		policy DuplicateLoginPolicy
+	}{
+		{"Reject", DuplicateLoginReject},
+		{"Kick old", DuplicateLoginKickOld},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			network := simulator.NewNetwork(simulator.Settings{}, 12)
+
+			server, endpoint := newTestEchoServer(true)
+			endpoint.DuplicateLoginPolicy = test.policy
+
+			// * Kicked connections must not count against the new one
+			endpoint.MaxConnectionsPerPID = 1
+
+			rejected := make(chan *Error, 1)
+			endpoint.OnConnectionRejected(func(connection *PRUDPConnection, err *Error) {
+				rejected <- err
+			})
+
+			replaced := make(chan *PRUDPConnection, 1)
+			endpoint.OnConnectionReplaced(func(oldConnection, newConnection *PRUDPConnection) {
+				replaced <- oldConnection
+			})
+
+			serverSocket, _ := network.Listen("127.0.0.1:60000")
+
+			go server.ServeUDP(serverSocket)
+			defer server.Shutdown(context.Background())
+
+			connect := func() (*PRUDPClient, error) {
+				clientSocket, _ := network.Listen("127.0.0.1:0")
+
+				client := NewPRUDPClient(1, 1)
+				client.Server.AccessKey = server.AccessKey
+				client.SetKerberosTicket(newTestKerberosTicket(server), testUserAccount.PID, 1)
+				t.Cleanup(func() { client.Close() })
+
+				ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+				defer cancel()
+
+				return client, client.ConnectUDP(ctx, clientSocket, serverSocket.LocalAddr())
+			}
+
+			first, err := connect()
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			oldConnection := endpoint.FindConnectionByPID(uint64(testUserAccount.PID))
+
+			second, err := connect()
+
+			if test.policy == DuplicateLoginReject {
+				assert.Error(t, err)
+				assert.Equal(t, ResultCodes.RendezVous.ConcurrentLoginDenied|uint32(errorMask), (<-rejected).ResultCode)
+				assert.Equal(t, oldConnection, endpoint.FindConnectionByPID(uint64(testUserAccount.PID)))
+
+				return
+			}
+
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			assert.Equal(t, oldConnection, <-replaced)
+			assert.Equal(t, 1, endpoint.Connections.Size())
+
+			// * The old client is told it was disconnected
+			select {
+			case <-first.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatal("Old client was not disconnected")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			_, err = second.Call(ctx, 0x64, 1, []byte{1, 2, 3})
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestPRUDPTransportConnectionMigration(t *testing.T) {
+	for _, prudpVersion := range []int{0, 1} {
+		network := simulator.NewNetwork(simulator.Settings{}, 13)
+
+		server, endpoint, client := newSimulatedConnection(t, network, prudpVersion)
+		endpoint.AllowConnectionMigration = true
+
+		migrated := make(chan net.Addr, 1)
+		endpoint.OnConnectionMigrated(func(connection *PRUDPConnection, oldAddress net.Addr) {
+			migrated <- oldAddress
+		})
+
+		oldAddress := client.Server.udpSocket.LocalAddr()
+
+		// * The clients NAT mapping changes
+		socket, _ := network.Listen("127.0.0.1:0")
+		serverAddress := client.Connection().Address()
+
+		client.Server.udpSocket = socket
+		go client.listenDatagram(socket, serverAddress)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		response, err := client.Call(ctx, 0x64, 1, []byte{1, 2, 3})
+		if assert.NoError(t, err) {
+			assert.Equal(t, []byte{1, 2, 3}, response.Parameters)
+		}
+
+		select {
+		case address := <-migrated:
+			assert.Equal(t, oldAddress.String(), address.String())
+		case <-time.After(5 * time.Second):
+			t.Fatal("Connection was not migrated")
+		}
+
+		assert.Equal(t, 1, endpoint.Connections.Size())
+		assert.Zero(t, server.HalfOpenConnections())
+
+		// * Packets from the old address are no longer accepted
+		_, ok := endpoint.Connections.Get(fmt.Sprintf("%s-%d-%d", oldAddress.String(), client.StreamType, client.Endpoint.StreamID))
+		assert.False(t, ok)
+	}
+}
+
+// recordingPacketConn is a socket which keeps a copy of everything sent through it
+type recordingPacketConn struct {
+	net.PacketConn
+	sync.Mutex
+	written [][]byte
+}
+
+func (rpc *recordingPacketConn) WriteTo(p []byte, address net.Addr) (int, error) {
+	rpc.Lock()
+	rpc.written = append(rpc.written, bytes.Clone(p))
+	rpc.Unlock()
+
+	return rpc.PacketConn.WriteTo(p, address)
+}
+
+func TestPRUDPTransportConnectionMigrationReplay(t *testing.T) {
+	for _, prudpVersion := range []int{0, 1} {
+		network := simulator.NewNetwork(simulator.Settings{}, 13)
+
+		_, endpoint, client := newSimulatedConnection(t, network, prudpVersion)
+		endpoint.AllowConnectionMigration = true
+
+		migrated := make(chan net.Addr, 1)
+		endpoint.OnConnectionMigrated(func(connection *PRUDPConnection, oldAddress net.Addr) {
+			migrated <- oldAddress
+		})
+
+		recorder := &recordingPacketConn{PacketConn: client.Server.udpSocket}
+		client.Server.udpSocket = recorder
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		_, err := client.Call(ctx, 0x64, 1, []byte{1, 2, 3})
+		assert.NoError(t, err)
+
+		// * Someone who captured the packets replays them from their own address
+		attacker, _ := network.Listen("127.0.0.1:0")
+		serverAddress := client.Connection().Address()
+
+		recorder.Lock()
+		for _, data := range recorder.written {
+			attacker.WriteTo(data, serverAddress)
+		}
+		recorder.Unlock()
+
+		select {
+		case <-migrated:
+			t.Fatal("Connection was migrated by replayed packets")
+		case <-time.After(500 * time.Millisecond):
+		}
+
+		_, ok := endpoint.Connections.Get(fmt.Sprintf("%s-%d-%d", recorder.LocalAddr().String(), client.StreamType, client.Endpoint.StreamID))
+		assert.True(t, ok)
+	}
+}
+
+func TestPRUDPTransportWorkerQueue(t *testing.T) {
+	for _, block := range []bool{false, true} {
+		network := simulator.NewNetwork(simulator.Settings{}, 14)
+
+		server, endpoint := newTestEchoServer(false)
+		server.WorkerCount = 1
+		server.WorkerQueueSize = 4
+		server.BlockOnFullWorkerQueue = block
+
+		serverSocket, _ := network.Listen("127.0.0.1:60000")
+		clientSocket, _ := network.Listen("127.0.0.1:0")
+
+		go server.ServeUDP(serverSocket)
+
+		client := NewPRUDPClient(1, 1)
+		client.Server.AccessKey = server.AccessKey
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if !assert.NoError(t, client.ConnectUDP(ctx, clientSocket, serverSocket.LocalAddr())) {
+			return
+		}
+
+		received := make(chan uint32, 100)
+
+		endpoint.OnData(func(packet PacketInterface) {
+			if !packet.(PRUDPPacketInterface).HasFlag(constants.PacketFlagReliable) {
+				received <- packet.RMCMessage().CallID
+			}
+		})
+
+		var serverConnection *PRUDPConnection
+		endpoint.Connections.Each(func(_ string, connection *PRUDPConnection) bool {
+			serverConnection = connection
+			return false
+		})
+
+		// * Holding the connection lock stalls the worker on the first packet
+		serverConnection.Lock()
+
+		for i := 0; i < 20; i++ {
+			request := NewRMCRequest(client.Endpoint)
+			request.ProtocolID = 0x64
+			request.MethodID = 1
+			request.CallID = uint32(i)
+
+			packet := client.newPacket(constants.DataPacket)
+			packet.SetPayload(request.Bytes())
+
+			client.Server.Send(packet)
+		}
+
+		if block {
+			assert.Eventually(t, func() bool {
+				return server.StalledPackets() != 0
+			}, 5*time.Second, time.Millisecond)
+		} else {
+			assert.Eventually(t, func() bool {
+				return server.DroppedPackets() != 0
+			}, 5*time.Second, time.Millisecond)
+		}
+
+		serverConnection.Unlock()
+
+		if block {
+			// * Nothing is dropped, and everything is processed in order
+			for i := 0; i < 20; i++ {
+				assert.Equal(t, uint32(i), <-received)
+			}
+
+			assert.Zero(t, server.DroppedPackets())
+		}
+
+		client.Close()
+		server.Shutdown(context.Background())
+	}
+}
+
+func TestPRUDPTransportDataHandlerConcurrency(t *testing.T) {
+	for _, concurrency := range []uint32{1, 2} {
+		network := simulator.NewNetwork(simulator.Settings{}, 15)
+
+		_, endpoint, client := newSimulatedConnection(t, network, 1)
+
+		var serverConnection *PRUDPConnection
+		endpoint.Connections.Each(func(_ string, connection *PRUDPConnection) bool {
+			serverConnection = connection
+			return false
+		})
+
+		serverConnection.Lock()
+		serverConnection.StreamSettings.DataHandlerConcurrency = concurrency
+		serverConnection.Unlock()
+
+		started := make(chan byte, 10)
+		unblock := make(chan struct{})
+
+		endpoint.OnData(func(packet PacketInterface) {
+			parameters := packet.RMCMessage().Parameters
+			started <- parameters[0]
+
+			if parameters[0] == 0 {
+				<-unblock
+			}
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		go client.Call(ctx, 0x64, 1, []byte{0})
+
+		assert.Equal(t, byte(0), <-started)
+
+		errs := make(chan error, 1)
+		go func() {
+			_, err := client.Call(ctx, 0x64, 1, []byte{1})
+			errs <- err
+		}()
+
+		if concurrency == 1 {
+			// * The second request is processed and acknowledged,
+			// * but waits for the first handler before being handled
+			assert.Eventually(t, func() bool {
+				return serverConnection.dataDispatcher.QueueDepth() == 1
+			}, 5*time.Second, time.Millisecond)
+
+			assert.Eventually(t, func() bool {
+				return client.Connection().SlidingWindow(0).InFlight() == 0
+			}, 5*time.Second, time.Millisecond)
+
+			assert.Empty(t, started)
+
+			close(unblock)
+
+			assert.Equal(t, byte(1), <-started)
+			assert.NoError(t, <-errs)
+		} else {
+			// * The second request is handled while the first handler is still running
+			assert.Equal(t, byte(1), <-started)
+			assert.NoError(t, <-errs)
+
+			close(unblock)
+		}
+	}
+}
+
+func TestPRUDPTransportBatchedUDP(t *testing.T) {
+	for _, prudpVersion := range []int{0, 1} {
+		t.Run(fmt.Sprintf("PRUDPv%d", prudpVersion), func(t *testing.T) {
+			server, _ := newTestEchoServer(false)
+			server.BatchSize = 8
+
+			serverSocket, err := net.ListenPacket("udp", "127.0.0.1:0")
+			assert.NoError(t, err)
+
+			go server.ServeUDP(serverSocket)
+			defer server.Shutdown(context.Background())
+
+			client := NewPRUDPClient(prudpVersion, 1)
+			client.Server.AccessKey = server.AccessKey
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			assert.NoError(t, client.Dial(ctx, serverSocket.LocalAddr().String()))
+			defer client.Close()
+
+			errs := make(chan error, 10)
+
+			// * Large parameters are fragmented, queueing many datagrams at once
+			for i := 0; i < cap(errs); i++ {
+				go func(i int) {
+					parameters := bytes.Repeat([]byte{byte(i)}, 1000*i)
+
+					response, err := client.Call(ctx, 0x64, 1, parameters)
+					if err == nil && !bytes.Equal(parameters, response.Parameters) {
+						err = assert.AnError
+					}
+
+					errs <- err
+				}(i)
+			}
+
+			for i := 0; i < cap(errs); i++ {
+				assert.NoError(t, <-errs)
+			}
+		})
+	}
+}
+
+func TestPRUDPTransportMultipleSockets(t *testing.T) {
+	server, _ := newTestEchoServer(false)
+
+	sockets, err := listenUDPSockets("127.0.0.1:0", 4)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	if reusePortSupported {
+		assert.Len(t, sockets, 4)
+	}
+
+	for _, socket := range sockets {
+		assert.Equal(t, sockets[0].LocalAddr().String(), socket.LocalAddr().String())
+	}
+
+	// * A second port, like one used for another region
+	socket, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	sockets = append(sockets, socket)
+
+	addresses := []string{sockets[0].LocalAddr().String(), socket.LocalAddr().String()}
+
+	// * Not every machine running the tests has IPv6
+	if socket, err := net.ListenPacket("udp6", "[::1]:0"); err == nil {
+		sockets = append(sockets, socket)
+		addresses = append(addresses, socket.LocalAddr().String())
+	}
+
+	go server.ServeUDPSockets(sockets...)
+	defer server.Shutdown(context.Background())
+
+	for _, address := range addresses {
+		client := NewPRUDPClient(1, 1)
+		client.Server.AccessKey = server.AccessKey
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+
+		// * Responses from any other socket would be ignored by the client
+		if assert.NoError(t, client.Dial(ctx, address), address) {
+			response, err := client.Call(ctx, 0x64, 1, []byte("ping"))
+			assert.NoError(t, err, address)
+
+			if assert.NotNil(t, response) {
+				assert.Equal(t, []byte("ping"), response.Parameters)
+			}
+		}
+
+		client.Close()
+		cancel()
+	}
+}
+
+func TestPRUDPTransportNoSockets(t *testing.T) {
+	server, _ := newTestEchoServer(false)
+
+	assert.Error(t, server.ServeUDPSockets())
+}
+
+func TestPRUDPTransportSendWithConfirmation(t *testing.T) {
+	network := simulator.NewNetwork(simulator.Settings{
+		PacketLoss: 0.1,
+	}, 12)
+
+	server, endpoint, client := newSimulatedConnection(t, network, 1)
+
+	templates := make(chan PRUDPPacketInterface, 1)
+	endpoint.OnData(func(packet PacketInterface) {
+		templates <- newTestResponsePacket(server, packet.(PRUDPPacketInterface), nil)
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := client.Call(ctx, 0x64, 1, []byte{1, 2, 3})
+	assert.NoError(t, err)
+
+	template := <-templates
+	connection := template.Sender().(*PRUDPConnection)
+
+	notification := NewRMCRequest(endpoint)
+	notification.ProtocolID = 0x64
+	notification.MethodID = 2
+	notification.Parameters = bytes.Repeat([]byte{1}, 5000)
+
+	// * Delivered once every fragment is acknowledged, despite the packet loss
+	packet := template.Copy()
+	packet.SetPayload(notification.Bytes())
+
+	assert.NoError(t, endpoint.SendWithConfirmation(packet).Wait(ctx))
+
+	// * Messages which don't fit in the send queue are dropped whole
+	connection.Lock()
+	connection.StreamSettings.MaxQueuedPackets = 2
+	connection.Unlock()
+
+	packet = template.Copy()
+	packet.SetPayload(notification.Bytes())
+
+	assert.ErrorIs(t, endpoint.SendWithConfirmation(packet).Wait(ctx), ErrDeliveryWindowOverflow)
+
+	// * The client stops answering, so the message runs out of retransmissions
+	connection.SlidingWindow(template.SubstreamID()).TimeoutManager.streamSettings.MaxPacketRetransmissions = 3
+	network.SetSettings(simulator.Settings{
+		PacketLoss: 1,
+	})
+
+	packet = template.Copy()
+	packet.SetPayload([]byte{1, 2, 3})
+
+	assert.ErrorIs(t, endpoint.SendWithConfirmation(packet).Wait(ctx), ErrDeliveryTimeout)
+
+	assert.Eventually(t, func() bool {
+		return endpoint.Connections.Size() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	packet = template.Copy()
+	packet.SetPayload([]byte{1, 2, 3})
+
+	assert.ErrorIs(t, endpoint.SendWithConfirmation(packet).Wait(ctx), ErrDeliveryConnectionClosed)
+}
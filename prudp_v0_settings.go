@@ -10,6 +10,8 @@ type PRUDPV0Settings struct {
 	EncryptedConnect              bool
 	LegacyConnectionSignature     bool
 	UseEnhancedChecksum           bool
+	VerifyChecksums               bool // * Drop inbound packets with an invalid checksum
+	VerifySignatures              bool // * Drop inbound packets with an invalid signature
 	ConnectionSignatureCalculator func(packet *PRUDPPacketV0, addr net.Addr) ([]byte, error)
 	SignatureCalculator           func(packet *PRUDPPacketV0, sessionKey, connectionSignature []byte) []byte
 	DataSignatureCalculator       func(packet *PRUDPPacketV0, sessionKey []byte) []byte
@@ -23,6 +25,8 @@ func NewPRUDPV0Settings() *PRUDPV0Settings {
 		EncryptedConnect:              false,
 		LegacyConnectionSignature:     false,
 		UseEnhancedChecksum:           false,
+		VerifyChecksums:               true,
+		VerifySignatures:              true,
 		ConnectionSignatureCalculator: defaultPRUDPv0ConnectionSignature,
 		SignatureCalculator:           defaultPRUDPv0CalculateSignature,
 		DataSignatureCalculator:       defaultPRUDPv0CalculateDataSignature,
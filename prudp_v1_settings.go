@@ -7,6 +7,7 @@ import "net"
 // PRUDPV1Settings defines settings for how to handle aspects of PRUDPv1 packets
 type PRUDPV1Settings struct {
 	LegacyConnectionSignature     bool
+	VerifySignatures              bool // * Drop inbound packets with an invalid signature
 	ConnectionSignatureCalculator func(packet *PRUDPPacketV1, addr net.Addr) ([]byte, error)
 	SignatureCalculator           func(packet *PRUDPPacketV1, sessionKey, connectionSignature []byte) []byte
 }
@@ -15,6 +16,7 @@ type PRUDPV1Settings struct {
 func NewPRUDPV1Settings() *PRUDPV1Settings {
 	return &PRUDPV1Settings{
 		LegacyConnectionSignature:     false,
+		VerifySignatures:              true,
 		ConnectionSignatureCalculator: defaultPRUDPv1ConnectionSignature,
 		SignatureCalculator:           defaultPRUDPv1CalculateSignature,
 	}
@@ -0,0 +1,16 @@
+//go:build !(linux || dragonfly)
+
+package nex
+
+import (
+	"errors"
+	"net"
+)
+
+// * Either SO_REUSEPORT doesn't exist, or it doesn't spread UDP datagrams across the sockets
+const reusePortSupported = false
+
+// listenReusePort is not supported on this platform. See listenUDPSockets
+func listenReusePort(_, _ string) (net.PacketConn, error) {
+	return nil, errors.New("SO_REUSEPORT is not supported on this platform")
+}
@@ -0,0 +1,35 @@
+//go:build linux || dragonfly
+
+package nex
+
+import (
+	"context"
+	"net"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// * Only enabled where the kernel spreads UDP datagrams across the sockets. Other BSDs and macOS accept
+// * SO_REUSEPORT too, but deliver everything to a single socket, which would leave the others idle
+const reusePortSupported = true
+
+// listenReusePort opens a UDP socket with SO_REUSEPORT set, so that several sockets can be bound to the same address
+func listenReusePort(network, address string) (net.PacketConn, error) {
+	config := net.ListenConfig{
+		Control: func(_, _ string, conn syscall.RawConn) error {
+			var err error
+
+			controlErr := conn.Control(func(fd uintptr) {
+				err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+			})
+			if controlErr != nil {
+				return controlErr
+			}
+
+			return err
+		},
+	}
+
+	return config.ListenPacket(context.Background(), network, address)
+}
@@ -41,22 +41,34 @@ func (rtt *RTT) Adjust(next time.Duration) {
 // GetRTTSmoothedAvg returns the smoothed average of this RTT, it is used in calls to the custom
 // RTO calculation function set on `PRUDPEndpoint::SetCalcRetransmissionTimeoutCallback`
 func (rtt *RTT) GetRTTSmoothedAvg() float64 {
+	rtt.Lock()
+	defer rtt.Unlock()
+
 	return rtt.average / 16
 }
 
 // GetRTTSmoothedDev returns the smoothed standard deviation of this RTT, it is used in calls to the custom
 // RTO calculation function set on `PRUDPEndpoint::SetCalcRetransmissionTimeoutCallback`
 func (rtt *RTT) GetRTTSmoothedDev() float64 {
+	rtt.Lock()
+	defer rtt.Unlock()
+
 	return rtt.variance / 8
 }
 
 // Initialized returns a bool indicating whether this RTT has been initialized
 func (rtt *RTT) Initialized() bool {
+	rtt.Lock()
+	defer rtt.Unlock()
+
 	return rtt.initialized
 }
 
 // GetRTO returns the current average
 func (rtt *RTT) Average() time.Duration {
+	rtt.Lock()
+	defer rtt.Unlock()
+
 	return time.Duration(rtt.average)
 }
 
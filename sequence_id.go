@@ -0,0 +1,19 @@
+package nex
+
+// * Sequence IDs are compared using serial number arithmetic, as described in RFC 1982.
+// * An ID comes before another if it is less than half the sequence space behind it,
+// * which keeps comparisons correct once IDs wrap around from 65535 back to 0.
+// * IDs exactly half the space apart can't be ordered, and neither comes before the other
+const sequenceIDHalfSpace uint16 = 1 << 15
+
+// sequenceIDLess returns whether sequence ID a comes before sequence ID b
+func sequenceIDLess(a, b uint16) bool {
+	distance := b - a
+
+	return distance != 0 && distance < sequenceIDHalfSpace
+}
+
+// sequenceIDLessOrEqual returns whether sequence ID a is b, or comes before it
+func sequenceIDLessOrEqual(a, b uint16) bool {
+	return a == b || sequenceIDLess(a, b)
+}
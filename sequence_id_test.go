@@ -0,0 +1,66 @@
+package nex
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSequenceIDLess(t *testing.T) {
+	for _, test := range []struct {
+		a, b uint16
+		less bool
+	}{
+		{1, 2, true},
+		{2, 1, false},
+		{5, 5, false},
+		{65535, 0, true},
+		{0, 65535, false},
+		{65000, 100, true},
+		{100, 65000, false},
+		{0, 32767, true},
+		{32767, 0, false},
+
+		// * Exactly half the sequence space apart, so neither comes first
+		{0, 32768, false},
+		{32768, 0, false},
+	} {
+		assert.Equal(t, test.less, sequenceIDLess(test.a, test.b), "%d < %d", test.a, test.b)
+	}
+
+	assert.True(t, sequenceIDLessOrEqual(65535, 65535))
+	assert.True(t, sequenceIDLessOrEqual(65535, 0))
+	assert.False(t, sequenceIDLessOrEqual(0, 65535))
+}
+
+func TestTimeoutManagerAcknowledgePacketsUpToAcrossWrap(t *testing.T) {
+	server := NewPRUDPServer()
+	endpoint := NewPRUDPEndPoint(1)
+	server.BindPRUDPEndPoint(endpoint)
+
+	connection := NewPRUDPConnection(NewSocketConnection(server, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 60000}, nil))
+	connection.endpoint = endpoint
+	connection.StreamSettings = endpoint.DefaultStreamSettings.Copy()
+
+	timeoutManager := NewTimeoutManager()
+	defer timeoutManager.Stop()
+
+	for _, sequenceID := range []uint16{65534, 65535, 0, 1, 2} {
+		packet, _ := NewPRUDPPacketV1(server, connection, nil)
+		packet.SetSequenceID(sequenceID)
+
+		timeoutManager.SchedulePacketTimeout(packet)
+	}
+
+	// * A plain <= would only acknowledge 0, and leave 65534 and 65535 pending forever
+	timeoutManager.AcknowledgePacketsUpTo(0)
+
+	pending := make([]uint16, 0)
+	timeoutManager.packets.Each(func(sequenceID uint16, _ PRUDPPacketInterface) bool {
+		pending = append(pending, sequenceID)
+		return false
+	})
+
+	assert.ElementsMatch(t, []uint16{1, 2}, pending)
+}
@@ -0,0 +1,208 @@
+// Package simulator implements an in-memory network for testing transports under bad network conditions.
+// Sockets created on a Network implement net.PacketConn, and can be used anywhere a UDP socket would be
+package simulator
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// Settings defines the conditions packets experience while traveling through a Network
+type Settings struct {
+	PacketLoss   float64       // * Chance, from 0 to 1, that a packet is dropped
+	Duplication  float64       // * Chance, from 0 to 1, that a packet is delivered twice
+	Reordering   float64       // * Chance, from 0 to 1, that a packet is held back by ReorderDelay, letting later packets overtake it
+	ReorderDelay time.Duration // * Extra delay added to reordered packets
+	Latency      time.Duration // * Base delay added to every packet
+	Jitter       time.Duration // * Maximum random delay added on top of Latency
+	MTU          int           // * Packets larger than this many bytes are truncated. 0 disables truncation
+}
+
+// Stats holds counters for everything a Network has done to the packets sent through it
+type Stats struct {
+	Sent       uint64 // * Packets written to the network
+	Delivered  uint64 // * Packets delivered to a socket, including duplicates
+	Dropped    uint64 // * Packets lost, sent to an unknown address or discarded because the receive buffer was full
+	Duplicated uint64 // * Packets delivered twice
+	Reordered  uint64 // * Packets held back by ReorderDelay
+	Truncated  uint64 // * Packets cut down to the MTU
+}
+
+// Network is an in-memory packet network. All randomness comes from a single seeded source,
+// so the same seed and the same sequence of writes always produces the same outcome
+type Network struct {
+	mutex    sync.Mutex
+	settings Settings
+	random   *rand.Rand
+	sockets  map[string]*PacketConn
+	nextPort int
+	stats    Stats
+}
+
+// SetSettings replaces the network conditions. Packets already in flight are not affected
+func (n *Network) SetSettings(settings Settings) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.settings = settings
+}
+
+// Settings returns the current network conditions
+func (n *Network) Settings() Settings {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.settings
+}
+
+// Stats returns a snapshot of the network counters
+func (n *Network) Stats() Stats {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	return n.stats
+}
+
+// Listen creates a new socket bound to the given address, such as "127.0.0.1:60000".
+// If the port is 0, a free port is chosen
+func (n *Network) Listen(address string) (*PacketConn, error) {
+	udpAddress, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	if udpAddress.IP == nil {
+		udpAddress.IP = net.IPv4(127, 0, 0, 1)
+	}
+
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if udpAddress.Port == 0 {
+		for n.sockets[(&net.UDPAddr{IP: udpAddress.IP, Port: n.nextPort}).String()] != nil {
+			n.nextPort++
+		}
+
+		udpAddress.Port = n.nextPort
+		n.nextPort++
+	}
+
+	if _, ok := n.sockets[udpAddress.String()]; ok {
+		return nil, fmt.Errorf("Address %s is already in use", udpAddress.String())
+	}
+
+	socket := newPacketConn(n, udpAddress)
+	n.sockets[udpAddress.String()] = socket
+
+	return socket, nil
+}
+
+// Pipe creates two sockets on the network with free ports
+func (n *Network) Pipe() (*PacketConn, *PacketConn, error) {
+	a, err := n.Listen("127.0.0.1:0")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	b, err := n.Listen("127.0.0.1:0")
+	if err != nil {
+		a.Close()
+		return nil, nil, err
+	}
+
+	return a, b, nil
+}
+
+func (n *Network) remove(socket *PacketConn) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if n.sockets[socket.address.String()] == socket {
+		delete(n.sockets, socket.address.String())
+	}
+}
+
+// send applies the network conditions to a packet and schedules its delivery.
+// data must not be modified by the caller afterwards
+func (n *Network) send(from *net.UDPAddr, to string, data []byte) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	n.stats.Sent++
+
+	destination, ok := n.sockets[to]
+	if !ok {
+		n.stats.Dropped++
+		return
+	}
+
+	// * Every random value is always drawn, even when a setting is
+	// * disabled, so changing one setting does not change the
+	// * outcome of the others for the same seed
+	lost := n.random.Float64() < n.settings.PacketLoss
+	duplicated := n.random.Float64() < n.settings.Duplication
+	reordered := n.random.Float64() < n.settings.Reordering
+	jitter := n.random.Float64()
+	duplicateJitter := n.random.Float64()
+
+	if lost {
+		n.stats.Dropped++
+		return
+	}
+
+	if n.settings.MTU > 0 && len(data) > n.settings.MTU {
+		data = data[:n.settings.MTU]
+		n.stats.Truncated++
+	}
+
+	delay := n.settings.Latency + time.Duration(jitter*float64(n.settings.Jitter))
+
+	if reordered {
+		delay += n.settings.ReorderDelay
+		n.stats.Reordered++
+	}
+
+	n.deliver(destination, from, data, delay)
+
+	if duplicated {
+		n.stats.Duplicated++
+		n.deliver(destination, from, data, n.settings.Latency+time.Duration(duplicateJitter*float64(n.settings.Jitter)))
+	}
+}
+
+// deliver must be called with the network mutex held
+func (n *Network) deliver(destination *PacketConn, from *net.UDPAddr, data []byte, delay time.Duration) {
+	if delay <= 0 {
+		n.push(destination, from, data)
+		return
+	}
+
+	time.AfterFunc(delay, func() {
+		n.mutex.Lock()
+		defer n.mutex.Unlock()
+
+		n.push(destination, from, data)
+	})
+}
+
+// push must be called with the network mutex held
+func (n *Network) push(destination *PacketConn, from *net.UDPAddr, data []byte) {
+	if destination.receive(datagram{from: from, data: data}) {
+		n.stats.Delivered++
+	} else {
+		n.stats.Dropped++
+	}
+}
+
+// NewNetwork returns a new Network with the given conditions. The seed controls every random decision the network makes
+func NewNetwork(settings Settings, seed int64) *Network {
+	return &Network{
+		settings: settings,
+		random:   rand.New(rand.NewSource(seed)),
+		sockets:  make(map[string]*PacketConn),
+		nextPort: 49152,
+	}
+}
@@ -0,0 +1,72 @@
+package simulator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sendAndCollect(t *testing.T, seed int64) []byte {
+	network := NewNetwork(Settings{
+		PacketLoss:  0.3,
+		Duplication: 0.2,
+	}, seed)
+
+	a, b, err := network.Pipe()
+	assert.NoError(t, err)
+
+	defer a.Close()
+	defer b.Close()
+
+	for i := 0; i < 100; i++ {
+		_, err := a.WriteTo([]byte{byte(i)}, b.LocalAddr())
+		assert.NoError(t, err)
+	}
+
+	received := make([]byte, 0)
+	buffer := make([]byte, 16)
+
+	for {
+		b.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+
+		read, from, err := b.ReadFrom(buffer)
+		if err != nil {
+			break
+		}
+
+		assert.Equal(t, a.LocalAddr().String(), from.String())
+		received = append(received, buffer[:read]...)
+	}
+
+	return received
+}
+
+func TestNetworkDeterministic(t *testing.T) {
+	first := sendAndCollect(t, 42)
+	second := sendAndCollect(t, 42)
+
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, 100, len(first))
+}
+
+func TestNetworkTruncation(t *testing.T) {
+	network := NewNetwork(Settings{MTU: 4}, 0)
+
+	a, b, err := network.Pipe()
+	assert.NoError(t, err)
+
+	_, err = a.WriteTo([]byte("truncated"), b.LocalAddr())
+	assert.NoError(t, err)
+
+	buffer := make([]byte, 16)
+	read, _, err := b.ReadFrom(buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, "trun", string(buffer[:read]))
+
+	assert.NoError(t, b.Close())
+
+	_, _, err = b.ReadFrom(buffer)
+	assert.Error(t, err)
+	assert.Equal(t, uint64(1), network.Stats().Truncated)
+}
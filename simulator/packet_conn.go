@@ -0,0 +1,179 @@
+package simulator
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// receiveBufferSize is the number of packets a socket holds before new packets are dropped
+const receiveBufferSize = 1024
+
+type datagram struct {
+	from *net.UDPAddr
+	data []byte
+}
+
+// PacketConn is a socket on a Network. It implements net.PacketConn using *net.UDPAddr addresses
+type PacketConn struct {
+	network       *Network
+	address       *net.UDPAddr
+	incoming      chan datagram
+	closed        chan struct{}
+	closeOnce     sync.Once
+	deadlineMutex sync.Mutex
+	readDeadline  time.Time
+	deadlineSet   chan struct{}
+}
+
+// ReadFrom reads the next packet sent to the socket
+func (pc *PacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		pc.deadlineMutex.Lock()
+		deadline := pc.readDeadline
+		deadlineSet := pc.deadlineSet
+		pc.deadlineMutex.Unlock()
+
+		var timer *time.Timer
+		var timeout <-chan time.Time
+
+		if !deadline.IsZero() {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return 0, nil, pc.opError("read", os.ErrDeadlineExceeded)
+			}
+
+			timer = time.NewTimer(remaining)
+			timeout = timer.C
+		}
+
+		// * Check for closing first, so a closed socket never
+		// * returns packets which were still buffered
+		select {
+		case <-pc.closed:
+			return 0, nil, pc.opError("read", net.ErrClosed)
+		default:
+		}
+
+		var packet datagram
+		var err error
+		received := false
+
+		select {
+		case packet = <-pc.incoming:
+			received = true
+		case <-pc.closed:
+			err = pc.opError("read", net.ErrClosed)
+		case <-timeout:
+			err = pc.opError("read", os.ErrDeadlineExceeded)
+		case <-deadlineSet:
+			// * The deadline changed while waiting, start over with the new one
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if received {
+			return copy(p, packet.data), packet.from, nil
+		}
+
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+}
+
+// WriteTo sends a packet to the given address. Like UDP, packets which are lost
+// or sent to an address nobody is listening on are not reported as errors
+func (pc *PacketConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	select {
+	case <-pc.closed:
+		return 0, pc.opError("write", net.ErrClosed)
+	default:
+	}
+
+	// * The caller is free to reuse p once we return
+	data := make([]byte, len(p))
+	copy(data, p)
+
+	pc.network.send(pc.address, addr.String(), data)
+
+	return len(p), nil
+}
+
+// Close closes the socket. Blocked reads return net.ErrClosed
+func (pc *PacketConn) Close() error {
+	closed := false
+
+	pc.closeOnce.Do(func() {
+		close(pc.closed)
+		pc.network.remove(pc)
+		closed = true
+	})
+
+	if !closed {
+		return pc.opError("close", net.ErrClosed)
+	}
+
+	return nil
+}
+
+// LocalAddr returns the address the socket is bound to
+func (pc *PacketConn) LocalAddr() net.Addr {
+	return pc.address
+}
+
+// SetDeadline sets the read deadline. Writes never block, so there is no write deadline
+func (pc *PacketConn) SetDeadline(t time.Time) error {
+	return pc.SetReadDeadline(t)
+}
+
+// SetReadDeadline sets the deadline for pending and future ReadFrom calls. A zero value disables the deadline
+func (pc *PacketConn) SetReadDeadline(t time.Time) error {
+	pc.deadlineMutex.Lock()
+	defer pc.deadlineMutex.Unlock()
+
+	pc.readDeadline = t
+
+	// * Wake up any blocked readers
+	close(pc.deadlineSet)
+	pc.deadlineSet = make(chan struct{})
+
+	return nil
+}
+
+// SetWriteDeadline does nothing, writes never block
+func (pc *PacketConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func (pc *PacketConn) receive(packet datagram) bool {
+	select {
+	case <-pc.closed:
+		return false
+	default:
+	}
+
+	select {
+	case pc.incoming <- packet:
+		return true
+	default:
+		return false
+	}
+}
+
+func (pc *PacketConn) opError(op string, err error) error {
+	return &net.OpError{Op: op, Net: "udp", Source: pc.address, Err: err}
+}
+
+func newPacketConn(network *Network, address *net.UDPAddr) *PacketConn {
+	return &PacketConn{
+		network:     network,
+		address:     address,
+		incoming:    make(chan datagram, receiveBufferSize),
+		closed:      make(chan struct{}),
+		deadlineSet: make(chan struct{}),
+	}
+}
@@ -1,14 +1,22 @@
 package nex
 
+import (
+	"sync"
+	"time"
+)
+
 // SlidingWindow is an implementation of rdv::SlidingWindow.
-// Currently this is a stub and does not reflect the interface and usage of rdv:SlidingWindow.
 // In the original library this is used to manage sequencing of outgoing packets.
-// each virtual connection stream only uses a single SlidingWindow, but starting
+// Each virtual connection stream only uses a single SlidingWindow, but starting
 // in PRUDPv1 with NEX virtual connections may have multiple reliable substreams and thus multiple SlidingWindows.
+// The window hands out sequence IDs and limits the number of reliable packets waiting on an acknowledgement
+// to StreamSettings.WindowSize. Packets sent while the window is full are queued until an acknowledgement frees a slot.
 type SlidingWindow struct {
 	sequenceIDCounter *Counter[uint16]
 	streamSettings    *StreamSettings
 	TimeoutManager    *TimeoutManager
+	queue             []PRUDPPacketInterface // * Packets waiting for room in the window
+	mutex             *sync.Mutex
 }
 
 // SetCipherKey sets the reliable substreams RC4 cipher keys
@@ -31,12 +39,99 @@ func (sw *SlidingWindow) Encrypt(data []byte) ([]byte, error) {
 	return sw.streamSettings.EncryptionAlgorithm.Encrypt(data)
 }
 
+// Submit sends a reliable packet if the window has room for it, otherwise the packet is queued.
+// The packet must already have its sequence ID, payload and signature set
+func (sw *SlidingWindow) Submit(packet PRUDPPacketInterface) {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+
+	// * Packets already waiting must go first, otherwise the
+	// * client would see sequence IDs out of order and the
+	// * RC4 streams would no longer line up
+	if len(sw.queue) != 0 || !sw.hasRoom() {
+		sw.queue = append(sw.queue, packet)
+		return
+	}
+
+	sw.transmit(packet)
+}
+
+// QueueDepth returns the number of packets waiting for room in the window
+func (sw *SlidingWindow) QueueDepth() int {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+
+	return len(sw.queue)
+}
+
+// InFlight returns the number of packets which have been sent and are waiting for an acknowledgement
+func (sw *SlidingWindow) InFlight() int {
+	return sw.TimeoutManager.packets.Size()
+}
+
+// Stop drops all queued packets and stops resending pending packets
+func (sw *SlidingWindow) Stop() {
+	sw.mutex.Lock()
+
+	for _, packet := range sw.queue {
+		if delivery := packet.getDelivery(); delivery != nil {
+			delivery.fail(ErrDeliveryConnectionClosed)
+		}
+	}
+
+	clear(sw.queue)
+	sw.queue = sw.queue[:0]
+	sw.mutex.Unlock()
+
+	sw.TimeoutManager.Stop()
+}
+
+// release sends as many queued packets as the window has room for. Called when packets are acknowledged
+func (sw *SlidingWindow) release() {
+	sw.mutex.Lock()
+	defer sw.mutex.Unlock()
+
+	for len(sw.queue) != 0 && sw.hasRoom() {
+		packet := sw.queue[0]
+		sw.queue[0] = nil
+		sw.queue = sw.queue[1:]
+
+		sw.transmit(packet)
+	}
+}
+
+func (sw *SlidingWindow) hasRoom() bool {
+	windowSize := sw.streamSettings.WindowSize
+
+	return windowSize == 0 || uint32(sw.TimeoutManager.packets.Size()) < windowSize
+}
+
+// transmit must be called with the mutex held
+func (sw *SlidingWindow) transmit(packet PRUDPPacketInterface) {
+	connection := packet.Sender().(*PRUDPConnection)
+	server := connection.endpoint.Server
+
+	packet.setSentAt(time.Now())
+
+	// * The packet must be pending before it is sent, or an ACK which arrives straight
+	// * away would be missed. The timer is only started once the packet has been written,
+	// * so a resend can't encode the packet while it is still being sent the first time
+	sw.TimeoutManager.track(packet)
+	server.writePacket(connection.Socket, packet)
+	sw.TimeoutManager.startTimer(packet)
+}
+
 // NewSlidingWindow initializes a new SlidingWindow with a starting counter value.
 func NewSlidingWindow() *SlidingWindow {
 	sw := &SlidingWindow{
 		sequenceIDCounter: NewCounter[uint16](0),
 		TimeoutManager:    NewTimeoutManager(),
+		streamSettings:    NewStreamSettings(),
+		queue:             make([]PRUDPPacketInterface, 0),
+		mutex:             &sync.Mutex{},
 	}
 
+	sw.TimeoutManager.onAcknowledge = sw.release
+
 	return sw
 }
@@ -12,6 +12,7 @@ type SocketConnection struct {
 	Server              *PRUDPServer // * PRUDP server the socket is connected to
 	Address             net.Addr     // * Sockets address
 	WebSocketConnection *gws.Conn    // * Only used in PRUDPLite
+	udpListener         *udpListener // * Server socket the client is talking to. nil for PRUDPLite
 }
 
 // NewSocketConnection creates a new SocketConnection
@@ -21,11 +21,26 @@ type StreamSettings struct {
 	SynInitialRTT                    uint32                // * The initial connection RTT used for all SYN packets
 	EncryptionAlgorithm              encryption.Algorithm  // * The encryption algorithm used for packet payloads
 	ExtraRetransmitTimeoutMultiplier float32               // * Used as part of the RTO calculations when retransmitting a packet. Only used if ExtraRestransmitTimeoutTrigger has been reached
-	WindowSize                       uint32                // * Unused. The max number of (reliable?) packets allowed in a SlidingWindow
+	WindowSize                       uint32                // * The max number of reliable packets a SlidingWindow can have waiting for an acknowledgement. 0 disables the limit
 	CompressionAlgorithm             compression.Algorithm // * The compression algorithm used for packet payloads
 	RTTRetransmit                    uint32                // * This is the number of times that a retried packet will be included in RTT calculations if we receive an ACK packet for it
 	RetransmitTimeoutMultiplier      float32               // * Used as part of the RTO calculations when retransmitting a packet. Only used if ExtraRestransmitTimeoutTrigger has not been reached
 	MaxSilenceTime                   uint32                // * Presumably the time a connection can go without any packets from the other side? Milliseconds?
+	PacingRate                       uint32                // * The max number of DATA packets sent to the connection per second. Lowered further based on the RTT. 0 disables pacing
+	PacingBurst                      uint32                // * The number of DATA packets which can be sent back to back before pacing starts
+	AggregateAckDelay                uint32                // * Milliseconds to hold acknowledgements for reliable DATA packets, so they can be sent together in one aggregate ACK. 0 acknowledges every packet individually
+	UnreliableReassemblyTimeout      uint32                // * Milliseconds to wait for the rest of a fragmented unreliable DATA message before its fragments are dropped. 0 waits forever
+	HandshakeTimeout                 uint32                // * Milliseconds a connection may take to complete the handshake after its SYN before it is removed. Also how long SYN cookies are valid for. 0 disables the timeout
+	DataHandlerConcurrency           uint32                // * The max number of DATA event handlers which may run at once for a connection. Handlers are started in the order packets were received. 0 is treated as 1
+	MaxReorderDistance               uint32                // * How far ahead of the next expected sequence ID a reliable packet may be before it is dropped. 0 disables the limit
+	MaxBufferedPackets               uint32                // * The max number of out of order reliable packets buffered per substream. Packets past this are dropped. 0 disables the limit
+	MaxReassembledMessageSize        uint32                // * The max size in bytes of a message reassembled from reliable fragments. Connections sending larger messages are disconnected. 0 disables the limit
+	FastRetransmitThreshold          uint32                // * The number of acknowledgements for later packets after which a pending reliable packet is resent without waiting for its RTO. 0 disables fast retransmit
+	ExponentialBackoff               bool                  // * Doubles the RTO with each resend, rather than growing it linearly with the send count
+	MaxRetransmitTimeout             uint32                // * Milliseconds the RTO of a packet may grow to, including RTOs from PRUDPEndPoint.CalcRetransmissionTimeoutCallback. 0 disables the limit
+	MaxQueuedPackets                 uint32                // * The max number of reliable packets waiting to be sent to a connection, either paced or waiting for room in the SlidingWindow. Messages which would go past this are dropped whole. 0 disables the limit
+	MaxUnreliableFragments           uint32                // * The max number of unreliable fragments kept while waiting for the rest of their messages. The oldest are dropped past this. 0 disables the limit
+	MaxUnreliableFragmentBytes       uint32                // * The max size in bytes of all unreliable fragments kept while waiting for the rest of their messages. The oldest are dropped past this. 0 disables the limit
 }
 
 // Copy returns a new copy of the settings
@@ -45,6 +60,21 @@ func (ss *StreamSettings) Copy() *StreamSettings {
 	copied.RTTRetransmit = ss.RTTRetransmit
 	copied.RetransmitTimeoutMultiplier = ss.RetransmitTimeoutMultiplier
 	copied.MaxSilenceTime = ss.MaxSilenceTime
+	copied.PacingRate = ss.PacingRate
+	copied.PacingBurst = ss.PacingBurst
+	copied.AggregateAckDelay = ss.AggregateAckDelay
+	copied.UnreliableReassemblyTimeout = ss.UnreliableReassemblyTimeout
+	copied.HandshakeTimeout = ss.HandshakeTimeout
+	copied.DataHandlerConcurrency = ss.DataHandlerConcurrency
+	copied.MaxReorderDistance = ss.MaxReorderDistance
+	copied.MaxBufferedPackets = ss.MaxBufferedPackets
+	copied.MaxReassembledMessageSize = ss.MaxReassembledMessageSize
+	copied.FastRetransmitThreshold = ss.FastRetransmitThreshold
+	copied.ExponentialBackoff = ss.ExponentialBackoff
+	copied.MaxRetransmitTimeout = ss.MaxRetransmitTimeout
+	copied.MaxQueuedPackets = ss.MaxQueuedPackets
+	copied.MaxUnreliableFragments = ss.MaxUnreliableFragments
+	copied.MaxUnreliableFragmentBytes = ss.MaxUnreliableFragmentBytes
 
 	return copied
 }
@@ -68,5 +98,20 @@ func NewStreamSettings() *StreamSettings {
 		RTTRetransmit:                    2, // * This value is taken from Xenoblade Chronicles, WATCH_DOGS sets this to 0x32 but it is then ignored. Setting this to 2 matches the TCP spec by not using resent packets in RTT calculations.
 		RetransmitTimeoutMultiplier:      1.25,
 		MaxSilenceTime:                   10000, // * This value is taken from Xenoblade Chronicles, WATCH_DOGS sets this to 5000.
+		PacingRate:                       60,    // * 1/60th of a second between packets was found to be a good balance with the friends server, and roughly matches the framerate most games target
+		PacingBurst:                      1,     // * Spaces out every packet, like the fixed delay between fragments this replaced
+		AggregateAckDelay:                0,
+		UnreliableReassemblyTimeout:      5000,
+		HandshakeTimeout:                 10000, // * Matches MaxSilenceTime, which is how long a connected client may stay quiet
+		DataHandlerConcurrency:           1,     // * Handlers run one at a time, in the order requests were received
+		MaxReorderDistance:               256,   // * Far larger than the window of any client seen so far
+		MaxBufferedPackets:               128,
+		MaxReassembledMessageSize:        4 * 1024 * 1024, // * Larger than any legitimate RMC message seen so far
+		FastRetransmitThreshold:          3,               // * Matches the duplicate ACK threshold of TCP, so a little reordering doesn't trigger resends
+		ExponentialBackoff:               false,           // * Off to keep the linear backoff of the original library
+		MaxRetransmitTimeout:             60000,           // * The upper bound RFC 6298 allows for the RTO of TCP. The linear backoff never reaches it with the default settings
+		MaxQueuedPackets:                 0,               // * Off so messages are never dropped unless asked for
+		MaxUnreliableFragments:           128,             // * Matches MaxBufferedPackets
+		MaxUnreliableFragmentBytes:       4 * 1024 * 1024, // * Matches MaxReassembledMessageSize
 	}
 }
@@ -1,7 +1,7 @@
 package nex
 
 import (
-	"context"
+	"sync/atomic"
 	"time"
 )
 
@@ -9,8 +9,8 @@ import (
 // Used to hold state related to resend timeouts on a packet
 type Timeout struct {
 	timeout time.Duration
-	ctx     context.Context
-	cancel  context.CancelFunc
+	timer   *wheelTimer
+	skipped atomic.Uint32 // * Acknowledgements for later packets received since the packet was last sent, see StreamSettings.FastRetransmitThreshold
 }
 
 // SetRTO sets the timeout field on this instance
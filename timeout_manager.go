@@ -1,98 +1,210 @@
 package nex
 
 import (
-	"context"
 	"time"
 )
 
-// TimeoutManager is an implementation of rdv::TimeoutManager and manages the resending of reliable PRUDP packets
+// TimeoutManager is an implementation of rdv::TimeoutManager and manages the resending of reliable PRUDP packets.
+// Resends are scheduled on the timerWheel of the connection the packets were sent to
 type TimeoutManager struct {
-	ctx            context.Context
-	cancel         context.CancelFunc
 	packets        *MutexMap[uint16, PRUDPPacketInterface]
 	streamSettings *StreamSettings
+	onAcknowledge  func() // * Called after a pending packet is acknowledged, freeing a slot in the SlidingWindow
 }
 
 // SchedulePacketTimeout adds a packet to the scheduler and begins it's timer
 func (tm *TimeoutManager) SchedulePacketTimeout(packet PRUDPPacketInterface) {
-	endpoint := packet.Sender().Endpoint().(*PRUDPEndPoint)
+	tm.track(packet)
+	tm.startTimer(packet)
+}
+
+// track adds a packet to the scheduler without starting its timer, so it can be acknowledged before it is resent
+func (tm *TimeoutManager) track(packet PRUDPPacketInterface) {
+	connection := packet.Sender().(*PRUDPConnection)
+	endpoint := connection.Endpoint().(*PRUDPEndPoint)
 
 	rto := endpoint.ComputeRetransmitTimeout(packet)
-	ctx, cancel := context.WithTimeout(tm.ctx, rto)
 
 	timeout := NewTimeout()
 	timeout.SetRTO(rto)
-	timeout.ctx = ctx
-	timeout.cancel = cancel
+	// * Run on its own goroutine, since it takes
+	// * the connection lock and the wheel must not block
+	timeout.timer = newWheelTimer(connection.timerWheel, func() {
+		go tm.retransmit(packet)
+	})
 	packet.setTimeout(timeout)
 
+	// * With no window size limit a sequence ID can still be
+	// * pending once the IDs wrap around. The old packet can't
+	// * be told apart from the new one anymore, so it is dropped
+	if pending, ok := tm.packets.Get(packet.SequenceID()); ok {
+		pending.getTimeout().timer.stop()
+
+		if delivery := pending.getDelivery(); delivery != nil {
+			delivery.fail(ErrDeliveryWindowOverflow)
+		}
+	}
+
 	tm.packets.Set(packet.SequenceID(), packet)
-	go tm.start(packet)
+}
+
+// startTimer starts the timer of a packet added with track
+func (tm *TimeoutManager) startTimer(packet PRUDPPacketInterface) {
+	timeout := packet.getTimeout()
+	timeout.timer.reset(timeout.RTO())
 }
 
 // AcknowledgePacket marks a pending packet as acknowledged. It will be ignored at the next resend attempt
 func (tm *TimeoutManager) AcknowledgePacket(sequenceID uint16) {
+	var acknowledged PRUDPPacketInterface
+
 	// * Acknowledge the packet
 	tm.packets.RunAndDelete(sequenceID, func(_ uint16, packet PRUDPPacketInterface) {
+		acknowledged = packet
+
+		packet.getTimeout().timer.stop()
+
 		// * Update the RTT on the connection if the packet hasn't been resent
 		if packet.SendCount() >= tm.streamSettings.RTTRetransmit {
 			rttm := time.Since(packet.SentAt())
 			packet.Sender().(*PRUDPConnection).rtt.Adjust(rttm)
 		}
 	})
+
+	if acknowledged == nil {
+		return
+	}
+
+	if delivery := acknowledged.getDelivery(); delivery != nil {
+		delivery.delivered()
+	}
+
+	// * Can't be done inside RunAndDelete, releasing
+	// * queued packets schedules new timeouts
+	if tm.onAcknowledge != nil {
+		tm.onAcknowledge()
+	}
 }
 
-func (tm *TimeoutManager) start(packet PRUDPPacketInterface) {
-	<-packet.getTimeout().ctx.Done()
+// AcknowledgePacketsUpTo marks every pending packet up to and including sequenceID as acknowledged.
+// Sequence IDs are compared using serial number arithmetic, so this works across the wrap from 65535 to 0
+func (tm *TimeoutManager) AcknowledgePacketsUpTo(sequenceID uint16) {
+	sequenceIDs := make([]uint16, 0)
+
+	// * MutexMap.Each locks the mutex, can't remove while reading.
+	// * Have to just loop again
+	tm.packets.Each(func(pendingID uint16, _ PRUDPPacketInterface) bool {
+		if sequenceIDLessOrEqual(pendingID, sequenceID) {
+			sequenceIDs = append(sequenceIDs, pendingID)
+		}
+
+		return false
+	})
+
+	for _, pendingID := range sequenceIDs {
+		tm.AcknowledgePacket(pendingID)
+	}
+}
 
+// retransmit is run by the timer of a packet once its RTO has passed without an acknowledgement.
+// It holds the connection lock, so the connection can't be closed while the packet is being checked
+func (tm *TimeoutManager) retransmit(packet PRUDPPacketInterface) {
 	connection := packet.Sender().(*PRUDPConnection)
 
+	connection.Lock()
+	defer connection.Unlock()
+
 	// * If the connection is closed stop trying to resend
 	if connection.ConnectionState != StateConnected {
+		if delivery := packet.getDelivery(); delivery != nil {
+			delivery.fail(ErrDeliveryConnectionClosed)
+		}
+
 		return
 	}
 
-	if tm.packets.Has(packet.SequenceID()) {
+	// * The packet may have been replaced by a newer one
+	// * with the same sequence ID, see SchedulePacketTimeout
+	if pending, ok := tm.packets.Get(packet.SequenceID()); ok && pending == packet {
 		endpoint := packet.Sender().Endpoint().(*PRUDPEndPoint)
 
 		// * This is `<` instead of `<=` for accuracy with observed behavior, even though we're comparing send count vs _resend_ max
 		if packet.SendCount() < tm.streamSettings.MaxPacketRetransmissions {
-			packet.incrementSendCount()
-			packet.setSentAt(time.Now())
-			rto := endpoint.ComputeRetransmitTimeout(packet)
-
-			ctx, cancel := context.WithTimeout(tm.ctx, rto)
-			timeout := packet.getTimeout()
-			timeout.timeout = rto
-			timeout.ctx = ctx
-			timeout.cancel = cancel
-
-			// * Schedule the packet to be resent
-			go tm.start(packet)
-
-			// * Resend the packet to the connection
-			server := connection.endpoint.Server
-			data := packet.Bytes()
-			server.SendRaw(connection.Socket, data)
+			tm.resend(packet)
 		} else {
+			if delivery := packet.getDelivery(); delivery != nil {
+				delivery.fail(ErrDeliveryTimeout)
+			}
+
 			// * Packet has been retried too many times, consider the connection dead
 			endpoint.CleanupConnection(connection)
 		}
 	}
 }
 
+// detectLoss counts an acknowledgement for sequenceID against every pending packet sent before it. A packet which
+// has been skipped over by StreamSettings.FastRetransmitThreshold acknowledgements was most likely lost, so it is
+// resent right away instead of waiting for its RTO
+func (tm *TimeoutManager) detectLoss(sequenceID uint16) {
+	threshold := tm.streamSettings.FastRetransmitThreshold
+	if threshold == 0 {
+		return
+	}
+
+	lost := make([]PRUDPPacketInterface, 0)
+
+	tm.packets.Each(func(pendingID uint16, packet PRUDPPacketInterface) bool {
+		if sequenceIDLess(pendingID, sequenceID) && packet.getTimeout().skipped.Add(1) == threshold {
+			lost = append(lost, packet)
+		}
+
+		return false
+	})
+
+	for _, packet := range lost {
+		// * Packets out of resends are left for their timer to clean up the connection.
+		// * If the timer can't be stopped it has already fired and resent the packet
+		if packet.SendCount() < tm.streamSettings.MaxPacketRetransmissions && packet.getTimeout().timer.stop() {
+			tm.resend(packet)
+		}
+	}
+}
+
+// resend sends a pending packet again and restarts its timer. The packet is written on its own goroutine,
+// since this is run by the timerWheel and writing may block on a slow socket
+func (tm *TimeoutManager) resend(packet PRUDPPacketInterface) {
+	connection := packet.Sender().(*PRUDPConnection)
+	endpoint := connection.endpoint
+
+	packet.incrementSendCount()
+	packet.setSentAt(time.Now())
+	rto := endpoint.ComputeRetransmitTimeout(packet)
+
+	timeout := packet.getTimeout()
+	timeout.timeout = rto
+	timeout.skipped.Store(0)
+
+	// * Schedule the packet to be resent
+	timeout.timer.reset(rto)
+
+	// * Resend the packet to the connection
+	go endpoint.Server.writePacket(connection.Socket, packet)
+}
+
 // Stop kills the resend scheduler and stops all pending packets
 func (tm *TimeoutManager) Stop() {
-	tm.cancel()
-	tm.packets.Clear(func(key uint16, value PRUDPPacketInterface) {})
+	tm.packets.Clear(func(_ uint16, packet PRUDPPacketInterface) {
+		packet.getTimeout().timer.stop()
+
+		if delivery := packet.getDelivery(); delivery != nil {
+			delivery.fail(ErrDeliveryConnectionClosed)
+		}
+	})
 }
 
 // NewTimeoutManager creates a new TimeoutManager
 func NewTimeoutManager() *TimeoutManager {
-	ctx, cancel := context.WithCancel(context.Background())
 	return &TimeoutManager{
-		ctx:            ctx,
-		cancel:         cancel,
 		packets:        NewMutexMap[uint16, PRUDPPacketInterface](),
 		streamSettings: NewStreamSettings(),
 	}
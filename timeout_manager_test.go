@@ -0,0 +1,133 @@
+package nex
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/PretendoNetwork/nex-go/v2/constants"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTimeoutConnection() (*PRUDPServer, *PRUDPEndPoint, *PRUDPConnection) {
+	server := NewPRUDPServer()
+	endpoint := NewPRUDPEndPoint(1)
+	server.BindPRUDPEndPoint(endpoint)
+
+	connection := NewPRUDPConnection(NewSocketConnection(server, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 60000}, nil))
+	connection.endpoint = endpoint
+	connection.StreamSettings = endpoint.DefaultStreamSettings.Copy()
+
+	return server, endpoint, connection
+}
+
+func TestTimeoutManagerFastRetransmit(t *testing.T) {
+	server, endpoint, connection := newTestTimeoutConnection()
+
+	// * Keeps the timers from resending anything themselves
+	endpoint.CalcRetransmissionTimeoutCallback = func(_ float64, _ uint32) time.Duration {
+		return time.Hour
+	}
+
+	timeoutManager := NewTimeoutManager()
+	timeoutManager.streamSettings.FastRetransmitThreshold = 3
+	defer timeoutManager.Stop()
+
+	packets := make([]PRUDPPacketInterface, 0)
+
+	for _, sequenceID := range []uint16{65534, 65535, 0, 1, 2, 3, 4} {
+		packet, _ := NewPRUDPPacketV1(server, connection, nil)
+		packet.SetSequenceID(sequenceID)
+		packet.incrementSendCount()
+
+		timeoutManager.SchedulePacketTimeout(packet)
+		packets = append(packets, packet)
+	}
+
+	// * 65534 was lost, everything after it arrives
+	for _, sequenceID := range []uint16{65535, 0} {
+		timeoutManager.AcknowledgePacket(sequenceID)
+		timeoutManager.detectLoss(sequenceID)
+	}
+
+	assert.Equal(t, uint32(1), packets[0].SendCount())
+
+	timeoutManager.AcknowledgePacket(1)
+	timeoutManager.detectLoss(1)
+
+	assert.Equal(t, uint32(2), packets[0].SendCount())
+
+	// * Resending starts the count again
+	for _, sequenceID := range []uint16{2, 3} {
+		timeoutManager.AcknowledgePacket(sequenceID)
+		timeoutManager.detectLoss(sequenceID)
+	}
+
+	assert.Equal(t, uint32(2), packets[0].SendCount())
+
+	timeoutManager.AcknowledgePacket(4)
+	timeoutManager.detectLoss(4)
+
+	assert.Equal(t, uint32(3), packets[0].SendCount())
+	assert.Equal(t, 1, timeoutManager.packets.Size())
+}
+
+func TestComputeRetransmitTimeoutBackoff(t *testing.T) {
+	server, endpoint, connection := newTestTimeoutConnection()
+	endpoint.DefaultStreamSettings.InitialRTT = 100
+	endpoint.DefaultStreamSettings.RetransmitTimeoutMultiplier = 1
+	connection.StreamSettings.MaxRetransmitTimeout = 1000
+
+	packet, _ := NewPRUDPPacketV1(server, connection, nil)
+	packet.SetType(constants.DataPacket)
+
+	rtos := func() []time.Duration {
+		packet.sendCount = 0
+		durations := make([]time.Duration, 0)
+
+		for i := 0; i < 6; i++ {
+			packet.incrementSendCount()
+			durations = append(durations, endpoint.ComputeRetransmitTimeout(packet))
+		}
+
+		return durations
+	}
+
+	ms := time.Millisecond
+
+	assert.Equal(t, []time.Duration{100 * ms, 200 * ms, 300 * ms, 400 * ms, 500 * ms, 600 * ms}, rtos())
+
+	connection.StreamSettings.ExponentialBackoff = true
+	assert.Equal(t, []time.Duration{100 * ms, 200 * ms, 400 * ms, 800 * ms, 1000 * ms, 1000 * ms}, rtos())
+
+	connection.StreamSettings.MaxRetransmitTimeout = 0
+	assert.Equal(t, []time.Duration{100 * ms, 200 * ms, 400 * ms, 800 * ms, 1600 * ms, 3200 * ms}, rtos())
+
+	// * The cap also applies to RTOs from the callback
+	connection.StreamSettings.MaxRetransmitTimeout = 1000
+	endpoint.CalcRetransmissionTimeoutCallback = func(_ float64, sendCount uint32) time.Duration {
+		return time.Duration(sendCount) * 300 * ms
+	}
+
+	assert.Equal(t, []time.Duration{300 * ms, 600 * ms, 900 * ms, 1000 * ms, 1000 * ms, 1000 * ms}, rtos())
+}
+
+func TestTimeoutManagerRetransmitClosedConnection(t *testing.T) {
+	server, _, connection := newTestTimeoutConnection()
+	connection.ConnectionState = StateNotConnected
+
+	timeoutManager := NewTimeoutManager()
+	defer timeoutManager.Stop()
+
+	delivery := newDeliveryHandle()
+	delivery.remaining.Store(1)
+
+	packet, _ := NewPRUDPPacketV1(server, connection, nil)
+	packet.setDelivery(delivery)
+
+	// * Fragments queued just before the connection was removed must not be left waiting forever
+	timeoutManager.track(packet)
+	timeoutManager.retransmit(packet)
+
+	assert.ErrorIs(t, delivery.Err(), ErrDeliveryConnectionClosed)
+}
@@ -0,0 +1,260 @@
+package nex
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	timerWheelTick      = 5 * time.Millisecond // * Resolution of every timer on a wheel
+	timerWheelLevels    = 4
+	timerWheelRootBits  = 8 // * The first level has 256 slots of one tick each
+	timerWheelLevelBits = 6 // * Every other level has 64 slots, each covering a whole turn of the level below
+)
+
+// timerList is a slot of a timerWheel
+type timerList struct {
+	head *wheelTimer
+}
+
+func (tl *timerList) push(timer *wheelTimer) {
+	timer.list = tl
+	timer.prev = nil
+	timer.next = tl.head
+
+	if tl.head != nil {
+		tl.head.prev = timer
+	}
+
+	tl.head = timer
+}
+
+func (tl *timerList) remove(timer *wheelTimer) {
+	if timer.prev != nil {
+		timer.prev.next = timer.next
+	} else {
+		tl.head = timer.next
+	}
+
+	if timer.next != nil {
+		timer.next.prev = timer.prev
+	}
+
+	timer.list = nil
+	timer.prev = nil
+	timer.next = nil
+}
+
+// timerWheel is a hierarchical timing wheel, used to run the retransmission, heartbeat and other timers of many
+// connections from a single goroutine rather than a goroutine or runtime timer for each. Timers are kept
+// in slots by the tick they expire on, and timers far in the future are moved down a level at a time as
+// their expiry gets closer. Starting, stopping and resetting a timer is O(1).
+//
+// The goroutine driving the wheel only runs while it has timers. Callbacks are run on that goroutine,
+// so they must not block. Anything which may block, such as emitting events or writing to a socket, must be run in a new goroutine
+type timerWheel struct {
+	mutex   sync.Mutex
+	start   time.Time
+	current uint64 // * Next tick to be processed
+	levels  [timerWheelLevels][]timerList
+	pending int
+	running bool
+}
+
+// now returns the current tick
+func (tw *timerWheel) now() uint64 {
+	return uint64(time.Since(tw.start) / timerWheelTick)
+}
+
+// add puts a timer in the slot for its expiry. Must be called with the mutex held
+func (tw *timerWheel) add(timer *wheelTimer) {
+	expires := max(timer.expires, tw.current)
+	delta := expires - tw.current
+
+	if delta < 1<<timerWheelRootBits {
+		tw.levels[0][expires&(1<<timerWheelRootBits-1)].push(timer)
+		return
+	}
+
+	shift := uint(timerWheelRootBits)
+
+	for level := 1; level < timerWheelLevels; level++ {
+		shift += timerWheelLevelBits
+
+		if delta < 1<<shift || level == timerWheelLevels-1 {
+			// * Timers past the range of the wheel wait in the last
+			// * slot they can, and are moved again once they get there
+			if delta >= 1<<shift {
+				expires = tw.current + 1<<shift - 1
+			}
+
+			index := (expires >> (shift - timerWheelLevelBits)) & (1<<timerWheelLevelBits - 1)
+			tw.levels[level][index].push(timer)
+
+			return
+		}
+	}
+}
+
+// advance processes every tick up to and including tick, appending the timers which expired to expired.
+// Must be called with the mutex held
+func (tw *timerWheel) advance(tick uint64, expired []*wheelTimer) []*wheelTimer {
+	for ; tw.current <= tick; tw.current++ {
+		shift := uint(timerWheelRootBits)
+
+		// * Each time a level completes a turn, the next slot of
+		// * the level above it is moved down into the wheel
+		for level := 1; level < timerWheelLevels; level++ {
+			if tw.current&(1<<shift-1) != 0 {
+				break
+			}
+
+			list := &tw.levels[level][(tw.current>>shift)&(1<<timerWheelLevelBits-1)]
+
+			for list.head != nil {
+				timer := list.head
+				list.remove(timer)
+				tw.add(timer)
+			}
+
+			shift += timerWheelLevelBits
+		}
+
+		list := &tw.levels[0][tw.current&(1<<timerWheelRootBits-1)]
+
+		for list.head != nil {
+			timer := list.head
+			list.remove(timer)
+			tw.pending--
+
+			expired = append(expired, timer)
+		}
+	}
+
+	return expired
+}
+
+// run fires timers as they expire, until the wheel is empty
+func (tw *timerWheel) run() {
+	ticker := time.NewTicker(timerWheelTick)
+	defer ticker.Stop()
+
+	expired := make([]*wheelTimer, 0)
+
+	for range ticker.C {
+		tw.mutex.Lock()
+
+		expired = tw.advance(tw.now(), expired[:0])
+		empty := tw.pending == 0
+
+		if empty {
+			tw.running = false
+		}
+
+		tw.mutex.Unlock()
+
+		for i, timer := range expired {
+			timer.callback()
+			expired[i] = nil
+		}
+
+		if empty {
+			return
+		}
+	}
+}
+
+// newTimerWheel returns a new timerWheel
+func newTimerWheel() *timerWheel {
+	tw := &timerWheel{
+		start: time.Now(),
+	}
+
+	for level := range tw.levels {
+		bits := timerWheelLevelBits
+		if level == 0 {
+			bits = timerWheelRootBits
+		}
+
+		tw.levels[level] = make([]timerList, 1<<bits)
+	}
+
+	return tw
+}
+
+// wheelTimer runs a callback once after a delay, like time.AfterFunc, using a timerWheel.
+// A timer may be reset any number of times, including from its own callback
+type wheelTimer struct {
+	wheel    *timerWheel
+	callback func()
+	expires  uint64
+	list     *timerList // * nil when the timer is not scheduled
+	prev     *wheelTimer
+	next     *wheelTimer
+}
+
+// reset schedules the timer to fire after delay, replacing any earlier schedule.
+// The delay is rounded up to the resolution of the wheel, so timers never fire early
+func (wt *wheelTimer) reset(delay time.Duration) {
+	tw := wt.wheel
+
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+
+	if wt.list != nil {
+		wt.list.remove(wt)
+	} else {
+		// * An empty wheel may have been idle for a long time.
+		// * There is nothing to move, so skip straight to now
+		if tw.pending == 0 {
+			tw.current = max(tw.current, tw.now())
+		}
+
+		tw.pending++
+	}
+
+	wt.expires = uint64((time.Since(tw.start) + delay + timerWheelTick - 1) / timerWheelTick)
+	tw.add(wt)
+
+	if !tw.running {
+		tw.running = true
+		go tw.run()
+	}
+}
+
+// stop unschedules the timer. Returns false if the timer was not scheduled, either because it was
+// never started, was already stopped, or has already fired. Like time.Timer.Stop, this does not wait
+// for a callback which is already running
+func (wt *wheelTimer) stop() bool {
+	tw := wt.wheel
+
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+
+	if wt.list == nil {
+		return false
+	}
+
+	wt.list.remove(wt)
+	tw.pending--
+
+	return true
+}
+
+// scheduled returns whether the timer is waiting to fire
+func (wt *wheelTimer) scheduled() bool {
+	tw := wt.wheel
+
+	tw.mutex.Lock()
+	defer tw.mutex.Unlock()
+
+	return wt.list != nil
+}
+
+// newWheelTimer returns a new timer on the wheel which runs callback when it fires. The timer is not started
+func newWheelTimer(wheel *timerWheel, callback func()) *wheelTimer {
+	return &wheelTimer{
+		wheel:    wheel,
+		callback: callback,
+	}
+}
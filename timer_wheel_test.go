@@ -0,0 +1,103 @@
+package nex
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimerWheelAdvance(t *testing.T) {
+	wheel := newTimerWheel()
+	fired := make(map[*wheelTimer]uint64)
+
+	// * Covers every level, the boundaries between them and
+	// * timers past the range of the wheel
+	expiries := []uint64{0, 1, 255, 256, 257, 1000, 1<<14 - 1, 1 << 14, 1<<14 + 300, 1 << 20, 1<<20 + 12345, 1 << 26, 1<<26 + 777}
+	timers := make([]*wheelTimer, len(expiries))
+
+	wheel.mutex.Lock()
+	defer wheel.mutex.Unlock()
+
+	for i, expires := range expiries {
+		timers[i] = newWheelTimer(wheel, nil)
+		timers[i].expires = expires
+		wheel.add(timers[i])
+		wheel.pending++
+	}
+
+	// * Stopped timers must never fire
+	stopped := newWheelTimer(wheel, nil)
+	stopped.expires = 300
+	wheel.add(stopped)
+	stopped.list.remove(stopped)
+
+	expired := make([]*wheelTimer, 0)
+
+	for tick := uint64(0); tick <= 1<<26+1000; tick++ {
+		expired = wheel.advance(tick, expired[:0])
+
+		for _, timer := range expired {
+			fired[timer] = tick
+		}
+	}
+
+	assert.Equal(t, 0, wheel.pending)
+	assert.NotContains(t, fired, stopped)
+
+	for i, timer := range timers {
+		assert.Equal(t, expiries[i], fired[timer], "timer expiring on tick %d", expiries[i])
+	}
+}
+
+func TestTimerWheelTimers(t *testing.T) {
+	wheel := newTimerWheel()
+
+	var fired atomic.Int64
+	done := make(chan time.Time, 1)
+
+	start := time.Now()
+	timer := newWheelTimer(wheel, func() {
+		done <- time.Now()
+	})
+	timer.reset(50 * time.Millisecond)
+
+	stopped := newWheelTimer(wheel, func() {
+		fired.Add(1)
+	})
+	stopped.reset(20 * time.Millisecond)
+	assert.True(t, stopped.stop())
+	assert.False(t, stopped.stop())
+
+	select {
+	case firedAt := <-done:
+		// * Timers may fire late, but never early
+		assert.GreaterOrEqual(t, firedAt.Sub(start), 50*time.Millisecond)
+	case <-time.After(time.Second):
+		assert.Fail(t, "Timer did not fire")
+	}
+
+	// * Resetting moves the timer instead of adding another
+	start = time.Now()
+	timer.reset(time.Hour)
+	timer.reset(30 * time.Millisecond)
+
+	select {
+	case firedAt := <-done:
+		assert.GreaterOrEqual(t, firedAt.Sub(start), 30*time.Millisecond)
+	case <-time.After(time.Second):
+		assert.Fail(t, "Reset timer did not fire")
+	}
+
+	assert.False(t, timer.stop())
+	assert.Equal(t, int64(0), fired.Load())
+
+	// * The goroutine driving the wheel stops once it is empty
+	assert.Eventually(t, func() bool {
+		wheel.mutex.Lock()
+		defer wheel.mutex.Unlock()
+
+		return !wheel.running
+	}, time.Second, timerWheelTick)
+}
@@ -0,0 +1,201 @@
+package nex
+
+import (
+	"net"
+	"sync"
+
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// * Large enough for any UDP datagram a client could send
+const maxDatagramSize = 64000
+
+// batchPacketConn is the part of ipv4.PacketConn and ipv6.PacketConn used for batched I/O
+type batchPacketConn interface {
+	ReadBatch(messages []ipv4.Message, flags int) (int, error)
+	WriteBatch(messages []ipv4.Message, flags int) (int, error)
+}
+
+// * How many batches worth of datagrams may wait for the writer before write blocks
+const udpBatchQueueBatches = 16
+
+// queuedDatagram is a datagram waiting to be sent by a udpBatchConn
+type queuedDatagram struct {
+	buffer  *[]byte
+	address net.Addr
+}
+
+// udpBatchConn reads and writes several datagrams per syscall on a UDP socket, using recvmmsg and
+// sendmmsg on Linux. Other platforms fall back to a single datagram per call inside x/net.
+//
+// Writes are coalesced. Datagrams are queued for a single writer goroutine, which sends everything
+// queued while the previous batch was being sent together. The queue is bounded, once it is full
+// write blocks until the writer catches up, much like a socket with a full send buffer
+type udpBatchConn struct {
+	conn      batchPacketConn
+	batchSize int
+	queue     chan queuedDatagram
+	messages  []ipv4.Message // * Only used by the writer goroutine
+	closed    chan struct{}
+	stopped   chan struct{} // * Closed once the writer goroutine has sent everything queued and exited
+	closeOnce sync.Once
+}
+
+// read reads up to len(messages) datagrams, blocking until at least one is available
+func (ubc *udpBatchConn) read(messages []ipv4.Message) (int, error) {
+	return ubc.conn.ReadBatch(messages, 0)
+}
+
+// write queues a copy of data to be sent to address. Blocks while the queue is full
+func (ubc *udpBatchConn) write(data []byte, address net.Addr) error {
+	// * Checked first, select picks at random when the queue has room too
+	select {
+	case <-ubc.closed:
+		return net.ErrClosed
+	default:
+	}
+
+	buffer := getPacketBuffer()
+	*buffer = append(*buffer, data...)
+
+	select {
+	case ubc.queue <- queuedDatagram{buffer: buffer, address: address}:
+		return nil
+	case <-ubc.closed:
+		putPacketBuffer(buffer)
+		return net.ErrClosed
+	}
+}
+
+// close stops the writer goroutine once it has sent every datagram already queued. The socket is not closed
+func (ubc *udpBatchConn) close() {
+	ubc.closeOnce.Do(func() {
+		close(ubc.closed)
+	})
+
+	<-ubc.stopped
+}
+
+// writeLoop sends queued datagrams in batches of up to batchSize until the udpBatchConn is closed
+func (ubc *udpBatchConn) writeLoop() {
+	defer close(ubc.stopped)
+
+	datagrams := make([]queuedDatagram, 0, ubc.batchSize)
+
+	for {
+		select {
+		case datagram := <-ubc.queue:
+			datagrams = append(datagrams, datagram)
+		case <-ubc.closed:
+			// * Send what was queued before closing, such as DISCONNECT packets
+			for len(ubc.queue) != 0 {
+				datagrams = ubc.fillBatch(datagrams)
+				ubc.send(datagrams)
+				datagrams = datagrams[:0]
+			}
+
+			return
+		}
+
+		datagrams = ubc.fillBatch(datagrams)
+		ubc.send(datagrams)
+
+		clear(datagrams)
+		datagrams = datagrams[:0]
+	}
+}
+
+// fillBatch adds queued datagrams to the batch until it is full or nothing else is queued
+func (ubc *udpBatchConn) fillBatch(datagrams []queuedDatagram) []queuedDatagram {
+	for len(datagrams) < ubc.batchSize {
+		select {
+		case datagram := <-ubc.queue:
+			datagrams = append(datagrams, datagram)
+		default:
+			return datagrams
+		}
+	}
+
+	return datagrams
+}
+
+// send writes datagrams to the socket in batches of batchSize, then returns their buffers to the pool
+func (ubc *udpBatchConn) send(datagrams []queuedDatagram) {
+	for remaining := datagrams; len(remaining) != 0; {
+		batch := ubc.messages[:min(len(remaining), ubc.batchSize)]
+
+		for i := range batch {
+			batch[i].Buffers[0] = *remaining[i].buffer
+			batch[i].Addr = remaining[i].address
+		}
+
+		sent, err := ubc.conn.WriteBatch(batch, 0)
+		remaining = remaining[sent:]
+
+		if err != nil {
+			logger.Error(err.Error())
+
+			// * Skip the datagram which failed so one bad
+			// * address does not hold up the rest
+			if len(remaining) != 0 {
+				remaining = remaining[1:]
+			}
+		}
+	}
+
+	for i := range ubc.messages {
+		ubc.messages[i].Buffers[0] = nil
+		ubc.messages[i].Addr = nil
+	}
+
+	for _, datagram := range datagrams {
+		putPacketBuffer(datagram.buffer)
+	}
+}
+
+// newUDPBatchConn returns a udpBatchConn for the socket, or nil if batching is disabled
+// or the socket is not a UDP socket, such as the simulator used by the tests
+func newUDPBatchConn(socket net.PacketConn, batchSize int) *udpBatchConn {
+	if batchSize <= 1 {
+		return nil
+	}
+
+	udpSocket, ok := socket.(*net.UDPConn)
+	if !ok {
+		return nil
+	}
+
+	var conn batchPacketConn
+
+	// * Dual stack sockets report an IPv6 address
+	if address, ok := udpSocket.LocalAddr().(*net.UDPAddr); ok && address.IP.To4() == nil {
+		conn = ipv6.NewPacketConn(udpSocket)
+	} else {
+		conn = ipv4.NewPacketConn(udpSocket)
+	}
+
+	return startUDPBatchConn(conn, batchSize)
+}
+
+// startUDPBatchConn returns a udpBatchConn for conn and starts its writer goroutine
+func startUDPBatchConn(conn batchPacketConn, batchSize int) *udpBatchConn {
+	messages := make([]ipv4.Message, batchSize)
+
+	for i := range messages {
+		messages[i].Buffers = make([][]byte, 1)
+	}
+
+	ubc := &udpBatchConn{
+		conn:      conn,
+		batchSize: batchSize,
+		queue:     make(chan queuedDatagram, batchSize*udpBatchQueueBatches),
+		messages:  messages,
+		closed:    make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+
+	go ubc.writeLoop()
+
+	return ubc
+}
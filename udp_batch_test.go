@@ -0,0 +1,108 @@
+package nex
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/ipv4"
+)
+
+// recordingBatchConn records the size of every batch written, blocking the first write until unblocked
+type recordingBatchConn struct {
+	mutex     sync.Mutex
+	batches   []int
+	datagrams [][]byte
+	started   chan struct{}
+	unblock   chan struct{}
+}
+
+func (rbc *recordingBatchConn) ReadBatch(_ []ipv4.Message, _ int) (int, error) {
+	return 0, net.ErrClosed
+}
+
+func (rbc *recordingBatchConn) WriteBatch(messages []ipv4.Message, _ int) (int, error) {
+	rbc.mutex.Lock()
+	first := len(rbc.batches) == 0
+	rbc.batches = append(rbc.batches, len(messages))
+
+	for _, message := range messages {
+		rbc.datagrams = append(rbc.datagrams, append([]byte(nil), message.Buffers[0]...))
+	}
+
+	rbc.mutex.Unlock()
+
+	if first {
+		close(rbc.started)
+		<-rbc.unblock
+	}
+
+	return len(messages), nil
+}
+
+func TestUDPBatchConnCoalescesWrites(t *testing.T) {
+	conn := &recordingBatchConn{
+		started: make(chan struct{}),
+		unblock: make(chan struct{}),
+	}
+
+	batchConn := startUDPBatchConn(conn, 4)
+	address := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 60000}
+
+	batchConn.write([]byte{0}, address)
+
+	<-conn.started
+
+	// * Written while the first batch is being sent, so
+	// * they are queued and sent together afterwards
+	for i := 1; i <= 6; i++ {
+		assert.NoError(t, batchConn.write([]byte{byte(i)}, address))
+	}
+
+	close(conn.unblock)
+	batchConn.close()
+
+	assert.Equal(t, []int{1, 4, 2}, conn.batches)
+	assert.Equal(t, [][]byte{{0}, {1}, {2}, {3}, {4}, {5}, {6}}, conn.datagrams)
+}
+
+func TestUDPBatchConnBoundedQueue(t *testing.T) {
+	conn := &recordingBatchConn{
+		started: make(chan struct{}),
+		unblock: make(chan struct{}),
+	}
+
+	batchConn := startUDPBatchConn(conn, 2)
+	address := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 60000}
+
+	batchConn.write([]byte{0}, address)
+
+	<-conn.started
+
+	for i := 0; i < 2*udpBatchQueueBatches; i++ {
+		assert.NoError(t, batchConn.write([]byte{1}, address))
+	}
+
+	// * The queue is full, so the next write waits for the writer
+	written := make(chan struct{})
+
+	go func() {
+		batchConn.write([]byte{2}, address)
+		close(written)
+	}()
+
+	select {
+	case <-written:
+		t.Fatal("Write did not block on a full queue")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(conn.unblock)
+	<-written
+	batchConn.close()
+
+	assert.Len(t, conn.datagrams, 2*udpBatchQueueBatches+2)
+	assert.ErrorIs(t, batchConn.write([]byte{3}, address), net.ErrClosed)
+}
@@ -0,0 +1,99 @@
+package nex
+
+import (
+	"net"
+)
+
+// udpListener is one of the UDP sockets a PRUDPServer is listening on.
+// Packets are always answered from the socket they were received on
+type udpListener struct {
+	socket    net.PacketConn
+	batchConn *udpBatchConn // * nil when batching is disabled or unsupported by the socket
+}
+
+// write sends data to address from the socket
+func (ul *udpListener) write(data []byte, address net.Addr) error {
+	if ul.batchConn != nil {
+		return ul.batchConn.write(data, address)
+	}
+
+	_, err := ul.socket.WriteTo(data, address)
+
+	return err
+}
+
+// close closes the socket, after sending any datagrams still waiting to be batched
+func (ul *udpListener) close() error {
+	if ul.batchConn != nil {
+		ul.batchConn.close()
+	}
+
+	return ul.socket.Close()
+}
+
+// newUDPListener returns a new udpListener for the socket
+func newUDPListener(socket net.PacketConn, batchSize int) *udpListener {
+	return &udpListener{
+		socket:    socket,
+		batchConn: newUDPBatchConn(socket, batchSize),
+	}
+}
+
+// udpNetwork returns the network to listen on for an address. IP addresses must use the network of their
+// family, since "udp" also accepts IPv4 clients on IPv6 sockets, which would stop an IPv4 and an IPv6
+// socket from both being bound to the same port
+func udpNetwork(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return "udp"
+	}
+
+	ip := net.ParseIP(host)
+
+	switch {
+	case ip == nil:
+		return "udp"
+	case ip.To4() != nil:
+		return "udp4"
+	default:
+		return "udp6"
+	}
+}
+
+// listenUDPSockets opens count sockets bound to the same address using SO_REUSEPORT, letting the kernel spread
+// clients across them. A single socket is opened if count is less than 2, or if SO_REUSEPORT is not supported
+func listenUDPSockets(address string, count int) ([]net.PacketConn, error) {
+	network := udpNetwork(address)
+
+	if count < 2 || !reusePortSupported {
+		socket, err := net.ListenPacket(network, address)
+		if err != nil {
+			return nil, err
+		}
+
+		return []net.PacketConn{socket}, nil
+	}
+
+	sockets := make([]net.PacketConn, 0, count)
+
+	for len(sockets) < count {
+		socket, err := listenReusePort(network, address)
+		if err != nil {
+			for _, socket := range sockets {
+				socket.Close()
+			}
+
+			return nil, err
+		}
+
+		// * Every socket must use the port the first was given
+		// * when the address leaves it up to the system
+		if len(sockets) == 0 {
+			address = socket.LocalAddr().String()
+		}
+
+		sockets = append(sockets, socket)
+	}
+
+	return sockets, nil
+}
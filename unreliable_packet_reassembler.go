@@ -0,0 +1,184 @@
+package nex
+
+import (
+	"container/list"
+	"time"
+)
+
+type unreliableFragment struct {
+	packet     PRUDPPacketInterface
+	payload    []byte // * Already decrypted
+	receivedAt time.Time
+}
+
+// UnreliablePacketReassembler rebuilds fragmented unreliable DATA messages.
+// Unreliable packets have no substreams, can be lost and can arrive in any order, so they cannot go through
+// a PacketDispatchQueue. Instead a fragmented message is sent using consecutive sequence IDs, with fragment IDs
+// counting up from 1 and a final packet using fragment ID 0. This lets every fragment of a message be found by
+// its sequence ID range, even when other messages are received in between. Fragments of messages which are
+// never completed are dropped after StreamSettings.UnreliableReassemblyTimeout, or oldest first once
+// StreamSettings.MaxUnreliableFragments or StreamSettings.MaxUnreliableFragmentBytes is reached
+type UnreliablePacketReassembler struct {
+	fragments     map[uint16]*list.Element // * Elements of arrivals, by sequence ID
+	arrivals      *list.List               // * Fragments in the order they were received, oldest first
+	bufferedBytes int
+}
+
+// Add stores a fragment and its decrypted payload. If the fragment completes a message, the final packet of the
+// message and the payload of the whole message are returned
+func (upr *UnreliablePacketReassembler) Add(packet PRUDPPacketInterface, payload []byte, settings *StreamSettings) (PRUDPPacketInterface, []byte, bool) {
+	upr.expire(time.Duration(settings.UnreliableReassemblyTimeout) * time.Millisecond)
+
+	// * A fragment which could never fit is dropped,
+	// * rather than dropping everything else for it
+	if maxBytes := settings.MaxUnreliableFragmentBytes; maxBytes != 0 && uint64(len(payload)) > uint64(maxBytes) {
+		return nil, nil, false
+	}
+
+	upr.remove(packet.SequenceID())
+	upr.fragments[packet.SequenceID()] = upr.arrivals.PushBack(&unreliableFragment{
+		packet:     packet,
+		payload:    payload,
+		receivedAt: time.Now(),
+	})
+	upr.bufferedBytes += len(payload)
+
+	for upr.overLimits(settings) {
+		upr.remove(upr.arrivals.Front().Value.(*unreliableFragment).packet.SequenceID())
+	}
+
+	if packet.getFragmentID() == 0 {
+		return upr.assemble(packet.SequenceID())
+	}
+
+	// * Look for the final fragment of the message,
+	// * in case this was the last missing piece
+	expectedFragmentID := packet.getFragmentID() + 1
+	sequenceID := packet.SequenceID() + 1
+
+	for {
+		fragment, ok := upr.fragment(sequenceID)
+		if !ok {
+			return nil, nil, false
+		}
+
+		fragmentID := fragment.packet.getFragmentID()
+
+		if fragmentID == 0 {
+			return upr.assemble(sequenceID)
+		}
+
+		if fragmentID != expectedFragmentID {
+			return nil, nil, false
+		}
+
+		expectedFragmentID++
+		sequenceID++
+	}
+}
+
+// continuesMessage returns whether a packet with fragment ID 0 is the final fragment of a stored message,
+// rather than a whole message on its own
+func (upr *UnreliablePacketReassembler) continuesMessage(packet PRUDPPacketInterface) bool {
+	previous, ok := upr.fragment(packet.SequenceID() - 1)
+
+	return ok && previous.packet.getFragmentID() != 0
+}
+
+// assemble builds the message ending at the given sequence ID, if all of its fragments have been received
+func (upr *UnreliablePacketReassembler) assemble(lastSequenceID uint16) (PRUDPPacketInterface, []byte, bool) {
+	last, ok := upr.fragment(lastSequenceID)
+	if !ok {
+		return nil, nil, false
+	}
+
+	previous, ok := upr.fragment(lastSequenceID - 1)
+	if !ok || previous.packet.getFragmentID() == 0 {
+		return nil, nil, false
+	}
+
+	fragmentCount := uint16(previous.packet.getFragmentID())
+	firstSequenceID := lastSequenceID - fragmentCount
+
+	for i := uint16(0); i < fragmentCount; i++ {
+		fragment, ok := upr.fragment(firstSequenceID + i)
+		if !ok || uint16(fragment.packet.getFragmentID()) != i+1 {
+			return nil, nil, false
+		}
+	}
+
+	payload := make([]byte, 0)
+
+	for i := uint16(0); i <= fragmentCount; i++ {
+		fragment, _ := upr.fragment(firstSequenceID + i)
+		payload = append(payload, fragment.payload...)
+		upr.remove(firstSequenceID + i)
+	}
+
+	return last.packet, payload, true
+}
+
+// expire drops fragments older than the timeout. Fragments are kept in the
+// order they were received, so only the expired ones need to be looked at
+func (upr *UnreliablePacketReassembler) expire(timeout time.Duration) {
+	if timeout == 0 {
+		return
+	}
+
+	for element := upr.arrivals.Front(); element != nil; element = upr.arrivals.Front() {
+		fragment := element.Value.(*unreliableFragment)
+		if time.Since(fragment.receivedAt) <= timeout {
+			return
+		}
+
+		upr.remove(fragment.packet.SequenceID())
+	}
+}
+
+// overLimits returns whether more fragments are stored than the settings allow
+func (upr *UnreliablePacketReassembler) overLimits(settings *StreamSettings) bool {
+	if maxFragments := settings.MaxUnreliableFragments; maxFragments != 0 && uint64(len(upr.fragments)) > uint64(maxFragments) {
+		return true
+	}
+
+	if maxBytes := settings.MaxUnreliableFragmentBytes; maxBytes != 0 && uint64(upr.bufferedBytes) > uint64(maxBytes) {
+		return true
+	}
+
+	return false
+}
+
+func (upr *UnreliablePacketReassembler) fragment(sequenceID uint16) (*unreliableFragment, bool) {
+	element, ok := upr.fragments[sequenceID]
+	if !ok {
+		return nil, false
+	}
+
+	return element.Value.(*unreliableFragment), true
+}
+
+func (upr *UnreliablePacketReassembler) remove(sequenceID uint16) {
+	element, ok := upr.fragments[sequenceID]
+	if !ok {
+		return
+	}
+
+	upr.bufferedBytes -= len(element.Value.(*unreliableFragment).payload)
+	upr.arrivals.Remove(element)
+	delete(upr.fragments, sequenceID)
+}
+
+// Purge drops all stored fragments
+func (upr *UnreliablePacketReassembler) Purge() {
+	clear(upr.fragments)
+	upr.arrivals.Init()
+	upr.bufferedBytes = 0
+}
+
+// NewUnreliablePacketReassembler returns a new UnreliablePacketReassembler
+func NewUnreliablePacketReassembler() *UnreliablePacketReassembler {
+	return &UnreliablePacketReassembler{
+		fragments: make(map[uint16]*list.Element),
+		arrivals:  list.New(),
+	}
+}
@@ -0,0 +1,84 @@
+package nex
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeFragment(sequenceID uint16, fragmentID uint8) PRUDPPacketInterface {
+	packet := makePacket(sequenceID)
+	packet.setFragmentID(fragmentID)
+
+	return packet
+}
+
+func TestUnreliableReassembleOutOfOrder(t *testing.T) {
+	upr := NewUnreliablePacketReassembler()
+	settings := NewStreamSettings()
+
+	_, _, ok := upr.Add(makeFragment(12, 0), []byte{3}, settings)
+	assert.False(t, ok)
+
+	_, _, ok = upr.Add(makeFragment(10, 1), []byte{1}, settings)
+	assert.False(t, ok)
+
+	last, payload, ok := upr.Add(makeFragment(11, 2), []byte{2}, settings)
+	assert.True(t, ok)
+	assert.Equal(t, uint16(12), last.SequenceID())
+	assert.Equal(t, []byte{1, 2, 3}, payload)
+	assert.Empty(t, upr.fragments)
+	assert.Zero(t, upr.bufferedBytes)
+}
+
+func TestUnreliableContinuesMessage(t *testing.T) {
+	upr := NewUnreliablePacketReassembler()
+	settings := NewStreamSettings()
+
+	// * Nothing stored before it, so this is a whole message
+	assert.False(t, upr.continuesMessage(makeFragment(11, 0)))
+
+	upr.Add(makeFragment(10, 1), []byte{1}, settings)
+	assert.True(t, upr.continuesMessage(makeFragment(11, 0)))
+	assert.False(t, upr.continuesMessage(makeFragment(12, 0)))
+}
+
+func TestUnreliableMaxFragments(t *testing.T) {
+	upr := NewUnreliablePacketReassembler()
+	settings := NewStreamSettings()
+	settings.MaxUnreliableFragments = 2
+
+	upr.Add(makeFragment(10, 1), []byte{1}, settings)
+	upr.Add(makeFragment(20, 1), []byte{2}, settings)
+	upr.Add(makeFragment(30, 1), []byte{3}, settings)
+
+	assert.Len(t, upr.fragments, 2)
+
+	_, payload, ok := upr.Add(makeFragment(31, 0), []byte{3}, settings)
+	assert.True(t, ok)
+	assert.Equal(t, []byte{3, 3}, payload)
+
+	// * The oldest message was dropped to make room
+	_, _, ok = upr.Add(makeFragment(11, 0), []byte{1}, settings)
+	assert.False(t, ok)
+}
+
+func TestUnreliableMaxFragmentBytes(t *testing.T) {
+	upr := NewUnreliablePacketReassembler()
+	settings := NewStreamSettings()
+	settings.MaxUnreliableFragmentBytes = 4
+
+	// * Larger than the limit on its own
+	upr.Add(makeFragment(10, 1), []byte{1, 1, 1, 1, 1}, settings)
+	assert.Empty(t, upr.fragments)
+
+	upr.Add(makeFragment(20, 1), []byte{2, 2}, settings)
+	upr.Add(makeFragment(30, 1), []byte{3, 3, 3}, settings)
+
+	assert.Len(t, upr.fragments, 1)
+	assert.Equal(t, 3, upr.bufferedBytes)
+
+	_, payload, ok := upr.Add(makeFragment(31, 0), []byte{3}, settings)
+	assert.True(t, ok)
+	assert.Equal(t, []byte{3, 3, 3, 3}, payload)
+}
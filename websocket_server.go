@@ -1,8 +1,10 @@
 package nex
 
 import (
-	"fmt"
+	"errors"
+	"net"
 	"net/http"
+	"sync"
 
 	"github.com/lxzan/gws"
 )
@@ -11,9 +13,13 @@ type wsEventHandler struct {
 	prudpServer *PRUDPServer
 }
 
-func (wseh *wsEventHandler) OnOpen(socket *gws.Conn) {}
+func (wseh *wsEventHandler) OnOpen(socket *gws.Conn) {
+	wseh.prudpServer.websocketServer.sockets.Set(socket, struct{}{})
+}
 
 func (wseh *wsEventHandler) OnClose(wsConn *gws.Conn, _ error) {
+	wseh.prudpServer.websocketServer.sockets.Delete(wsConn)
+
 	// * Loop over all connections on all endpoints
 	wseh.prudpServer.Endpoints.Each(func(streamid uint8, pep *PRUDPEndPoint) bool {
 		connections := make([]*PRUDPConnection, 0)
@@ -45,11 +51,10 @@ func (wseh *wsEventHandler) OnPong(socket *gws.Conn, payload []byte) {}
 func (wseh *wsEventHandler) OnMessage(socket *gws.Conn, message *gws.Message) {
 	defer message.Close()
 
-	// * Create a COPY of the underlying *bytes.Buffer bytes.
-	// * If this is not done, then the byte slice sometimes
-	// * gets modified in unexpected places
-	packetData := append([]byte(nil), message.Bytes()...)
-	err := wseh.prudpServer.handleSocketMessage(packetData, socket.RemoteAddr(), socket)
+	// * gws reuses the underlying buffer once the message is
+	// * closed. This is safe since packets copy everything
+	// * they keep out of the message while being decoded
+	err := wseh.prudpServer.handleSocketMessage(message.Bytes(), NewSocketConnection(wseh.prudpServer, socket.RemoteAddr(), socket))
 	if err != nil {
 		logger.Error(err.Error())
 	}
@@ -57,12 +62,21 @@ func (wseh *wsEventHandler) OnMessage(socket *gws.Conn, message *gws.Message) {
 
 // WebSocketServer wraps a WebSocket server to create an easier API to consume
 type WebSocketServer struct {
+	server      *http.Server
 	mux         *http.ServeMux
 	upgrader    *gws.Upgrader
 	prudpServer *PRUDPServer
+	sockets     *MutexMap[*gws.Conn, struct{}]
+	mutex       sync.Mutex // * Guards server and sockets, which are set by serve while close may be running
 }
 
-func (ws *WebSocketServer) init() {
+// init creates the HTTP server and returns it, so that serving it does not need the mutex
+func (ws *WebSocketServer) init() *http.Server {
+	ws.mutex.Lock()
+	defer ws.mutex.Unlock()
+
+	ws.sockets = NewMutexMap[*gws.Conn, struct{}]()
+
 	ws.upgrader = gws.NewUpgrader(&wsEventHandler{
 		prudpServer: ws.prudpServer,
 	}, &gws.ServerOption{
@@ -83,22 +97,63 @@ func (ws *WebSocketServer) init() {
 			socket.ReadLoop() // * Blocking prevents the context from being GC
 		}()
 	})
+
+	ws.server = &http.Server{
+		Handler: ws.mux,
+	}
+
+	return ws.server
 }
 
-func (ws *WebSocketServer) listen(port int) {
-	ws.init()
+func (ws *WebSocketServer) serve(listener net.Listener) error {
+	server := ws.init()
 
-	err := http.ListenAndServe(fmt.Sprintf(":%d", port), ws.mux)
-	if err != nil {
-		panic(err)
+	// * If close already ran, this returns http.ErrServerClosed
+	err := server.Serve(listener)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
 	}
+
+	return nil
 }
 
-func (ws *WebSocketServer) listenSecure(port int, certFile, keyFile string) {
-	ws.init()
+func (ws *WebSocketServer) serveSecure(listener net.Listener, certFile, keyFile string) error {
+	server := ws.init()
 
-	err := http.ListenAndServeTLS(fmt.Sprintf(":%d", port), certFile, keyFile, ws.mux)
-	if err != nil {
-		panic(err)
+	// * If close already ran, this returns http.ErrServerClosed
+	err := server.ServeTLS(listener, certFile, keyFile)
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// close stops accepting new WebSocket connections and closes all open sockets
+func (ws *WebSocketServer) close() {
+	ws.mutex.Lock()
+	server := ws.server
+	socketMap := ws.sockets
+	ws.mutex.Unlock()
+
+	if server == nil {
+		return
+	}
+
+	if err := server.Close(); err != nil {
+		logger.Error(err.Error())
+	}
+
+	sockets := make([]*gws.Conn, 0, socketMap.Size())
+
+	socketMap.Each(func(socket *gws.Conn, _ struct{}) bool {
+		sockets = append(sockets, socket)
+		return false
+	})
+
+	// * Upgraded sockets are hijacked from the HTTP server,
+	// * so they are not closed along with it
+	for _, socket := range sockets {
+		socket.WriteClose(1001, nil)
 	}
 }